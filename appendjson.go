@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errValueNotJSONArray = errors.New("value is not a JSON array")
+
+type AppendJSONRequest struct {
+	Key     string          `json:"key"`
+	Element json.RawMessage `json:"element"`
+}
+
+type AppendJSONResponse struct {
+	Status string `json:"status"`
+	Length int    `json:"length"`
+}
+
+// AppendJSON appends element to the JSON array stored under key and returns
+// the new length. The read, append and write happen under one write lock,
+// so concurrent appends never lose each other's elements. A missing key is
+// created as a one-element array. The key keeps its TTL and content type.
+func (kvs *KeyValueStore) AppendJSON(key string, element json.RawMessage) (int, error) {
+	key = kvs.normalizeKey(key)
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	var arr []json.RawMessage
+	current, exists := kvs.lookupLocked(key, time.Now())
+	if exists {
+		if !strings.HasPrefix(strings.TrimSpace(current), "[") {
+			return 0, errValueNotJSONArray
+		}
+		if err := json.Unmarshal([]byte(current), &arr); err != nil {
+			return 0, errValueNotJSONArray
+		}
+	}
+	arr = append(arr, element)
+
+	updated, err := encodeJSONValue(arr)
+	if err != nil {
+		return 0, err
+	}
+	if err := kvs.updateLocked(key, updated); err != nil {
+		return 0, err
+	}
+	return len(arr), nil
+}
+
+func (kvs *KeyValueStore) handleAppendJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req AppendJSONRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if kvs.normalizeKey(req.Key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.Element) == 0 {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Missing element"}, http.StatusBadRequest)
+		return
+	}
+
+	length, err := kvs.AppendJSON(req.Key, req.Element)
+	if errors.Is(err, errValueNotJSONArray) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeValueNotJSON, Error: err.Error()}, http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, AppendJSONResponse{Status: "OK", Length: length}, http.StatusOK)
+}
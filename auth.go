@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// API key secrets are stored as bcrypt hashes, made with apiKeyHashCost by
+// -hash-api-key.
+const apiKeyHashCost = bcrypt.DefaultCost
+
+// Each bcrypt check costs real CPU, so a client IP that fails
+// authFailureLimit times for one key ID within authFailureWindow gets no
+// more checks for that ID until the window is over. Counting by IP means
+// nobody else can lock a real ID out, and unknown IDs all share one limit
+// per IP, so made-up IDs can't multiply it. Expired counts are swept once
+// there are authFailureSweepSize of them.
+const (
+	authFailureLimit     = 10
+	authFailureWindow    = time.Minute
+	authFailureSweepSize = 1024
+)
+
+// errInvalidAPIKey and errTooManyAttempts are the ways check can fail.
+var (
+	errInvalidAPIKey   = errors.New("invalid API key")
+	errTooManyAttempts = errors.New("too many failed attempts")
+)
+
+// API key roles. Read-only keys may call any GET or HEAD endpoint except
+// /ui and those under /admin/, plus the read-only POST endpoints in
+// readOnlyPosts.
+const (
+	RoleRead      = "read"
+	RoleReadWrite = "readwrite"
+)
+
+// readOnlyPosts lists POST endpoints that never modify the store.
+var readOnlyPosts = map[string]bool{
+	"/consistent_get": true,
+}
+
+// apiKeyHash is one parsed credentials file entry.
+type apiKeyHash struct {
+	hash []byte
+	role string
+}
+
+// apiKeyEntry is the object form of a credentials file entry. A bare string
+// entry is a hash with RoleReadWrite.
+type apiKeyEntry struct {
+	Hash string `json:"hash"`
+	Role string `json:"role"`
+}
+
+// apiKeySet holds the named API keys from -credentials-file. Clients
+// authenticate with HTTP Basic auth, using the key ID as the user name and
+// the secret as the password. A nil *apiKeySet means authentication is off.
+type apiKeySet struct {
+	hashes map[string]apiKeyHash
+
+	// dummy is checked in place of an unknown ID's hash, with the highest
+	// cost of the real ones, so a miss takes as long as a wrong secret for
+	// a real ID.
+	dummy apiKeyHash
+
+	mu sync.Mutex
+	// verified caches a digest of each secret that has matched, so only a
+	// key's first request pays for the deliberately slow bcrypt check.
+	verified map[string][sha256.Size]byte
+	// failures counts recent failed checks by client IP and key ID, with
+	// "" as the ID for unknown IDs. nextSweep is the size at which expired
+	// counts are next swept out.
+	failures  map[authFailureKey]*authFailures
+	nextSweep int
+}
+
+// authFailureKey identifies the client IP and key ID failures count
+// against.
+type authFailureKey struct {
+	ip, id string
+}
+
+// authFailures counts the failed checks since start.
+type authFailures struct {
+	count int
+	start time.Time
+}
+
+// apiKeyStore holds the current apiKeySet, so a config reload can swap in
+// new credentials while requests are being checked. Holding nil means
+// authentication is off.
+type apiKeyStore struct {
+	atomic.Pointer[apiKeySet]
+}
+
+// hashAPIKeySecret returns the credentials file form of secret.
+func hashAPIKeySecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), apiKeyHashCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// loadAPIKeys reads a JSON object mapping key IDs to either a hashed secret
+// or a {"hash": ..., "role": ...} object. An empty path disables
+// authentication and returns nil.
+func loadAPIKeys(path string) (*apiKeySet, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no API keys defined", path)
+	}
+
+	keys := &apiKeySet{
+		hashes:   make(map[string]apiKeyHash, len(entries)),
+		verified: make(map[string][sha256.Size]byte),
+		failures: make(map[authFailureKey]*authFailures),
+	}
+	dummyCost := bcrypt.MinCost
+	for id, raw := range entries {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("%s: invalid key ID %q", path, id)
+		}
+		entry := apiKeyEntry{Role: RoleReadWrite}
+		if err := json.Unmarshal(raw, &entry.Hash); err != nil {
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return nil, fmt.Errorf("%s: key %q: expected a hash string or {\"hash\", \"role\"} object", path, id)
+			}
+		}
+		if entry.Role != RoleRead && entry.Role != RoleReadWrite {
+			return nil, fmt.Errorf("%s: key %q: role must be %s or %s", path, id, RoleRead, RoleReadWrite)
+		}
+		cost, err := bcrypt.Cost([]byte(entry.Hash))
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: invalid bcrypt hash: %w", path, id, err)
+		}
+		keys.hashes[id] = apiKeyHash{hash: []byte(entry.Hash), role: entry.Role}
+		dummyCost = max(dummyCost, cost)
+	}
+	dummy, err := randomHash(dummyCost)
+	if err != nil {
+		return nil, err
+	}
+	keys.dummy.hash = dummy
+	return keys, nil
+}
+
+// randomHash returns a bcrypt hash of a random secret, for apiKeySet.dummy.
+// The secret is thrown away, so checks against the hash fail.
+func randomHash(cost int) ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return bcrypt.GenerateFromPassword(secret, cost)
+}
+
+// check returns the role of key ID id if secret is its secret, for a
+// request from client IP ip. A secret that has matched before is
+// recognized from the cache without a bcrypt check, so a client already
+// using its key keeps working while its IP is over authFailureLimit.
+func (keys *apiKeySet) check(ip, id, secret string, now time.Time) (string, error) {
+	h, known := keys.hashes[id]
+	bucket := authFailureKey{ip: ip, id: id}
+	if !known {
+		h, bucket.id = keys.dummy, ""
+	}
+
+	digest := sha256.Sum256([]byte(secret))
+	keys.mu.Lock()
+	if cached, ok := keys.verified[id]; ok && known && subtle.ConstantTimeCompare(cached[:], digest[:]) == 1 {
+		keys.mu.Unlock()
+		return h.role, nil
+	}
+	// The attempt counts as a failure until it succeeds, so concurrent
+	// requests can't all slip under the limit before any of them fails.
+	f := keys.failures[bucket]
+	if f == nil || now.Sub(f.start) >= authFailureWindow {
+		if f == nil {
+			keys.sweepFailuresLocked(now)
+		}
+		f = &authFailures{start: now}
+		keys.failures[bucket] = f
+	}
+	if f.count >= authFailureLimit {
+		keys.mu.Unlock()
+		return "", errTooManyAttempts
+	}
+	f.count++
+	keys.mu.Unlock()
+
+	if err := bcrypt.CompareHashAndPassword(h.hash, []byte(secret)); err != nil || !known {
+		return "", errInvalidAPIKey
+	}
+	keys.mu.Lock()
+	f.count--
+	keys.verified[id] = digest
+	keys.mu.Unlock()
+	return h.role, nil
+}
+
+// sweepFailuresLocked drops expired failure counts once there are at least
+// nextSweep of them, so counts for IPs that have gone away don't pile up.
+// The next sweep waits until the live counts have doubled, which keeps the
+// cost of sweeping proportional to the counts added. Callers hold keys.mu.
+func (keys *apiKeySet) sweepFailuresLocked(now time.Time) {
+	if len(keys.failures) < max(keys.nextSweep, authFailureSweepSize) {
+		return
+	}
+	for k, f := range keys.failures {
+		if now.Sub(f.start) >= authFailureWindow {
+			delete(keys.failures, k)
+		}
+	}
+	keys.nextSweep = 2 * len(keys.failures)
+}
+
+// allowedForRead reports whether a read-only key may make request r.
+func allowedForRead(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/admin/") || r.URL.Path == "/ui" {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return readOnlyPosts[r.URL.Path]
+	}
+	return false
+}
+
+// IDs returns the configured key IDs in sorted order.
+func (keys *apiKeySet) IDs() []string {
+	ids := make([]string, 0, len(keys.hashes))
+	for id := range keys.hashes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// authMiddleware rejects requests without a valid API key, and requests a
+// read-only key isn't allowed to make, before any handler runs. /health
+// stays open so load balancers can probe the server without credentials.
+func (s *apiKeyStore) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keys := s.Load(); keys != nil && r.URL.Path != "/health" {
+			id, secret, ok := r.BasicAuth()
+			role, err := "", errInvalidAPIKey
+			if ok {
+				role, err = keys.check(requestIP(r), id, secret, time.Now())
+			}
+			if errors.Is(err, errTooManyAttempts) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(authFailureWindow.Seconds())))
+				sendJSONResponse(w, ErrorResponse{Code: CodeTooManyAttempts, Error: "Too many failed attempts for this API key from this address"}, http.StatusTooManyRequests)
+				return
+			} else if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="kvstore"`)
+				sendJSONResponse(w, ErrorResponse{Code: CodeUnauthorized, Error: "Invalid or missing API key"}, http.StatusUnauthorized)
+				return
+			}
+			if role == RoleRead && !allowedForRead(r) {
+				sendJSONResponse(w, ErrorResponse{Code: CodeForbidden, Error: "API key is read-only"}, http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type APIKeysResponse struct {
+	IDs   []string          `json:"ids"`
+	Roles map[string]string `json:"roles"`
+}
+
+func (s *apiKeyStore) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	keys := s.Load()
+	if keys == nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeFeatureDisabled, Error: "API keys are not enabled"}, http.StatusNotFound)
+		return
+	}
+
+	roles := make(map[string]string, len(keys.hashes))
+	for id, h := range keys.hashes {
+		roles[id] = h.role
+	}
+	sendJSONResponse(w, APIKeysResponse{IDs: keys.IDs(), Roles: roles}, http.StatusOK)
+}
+
+// runHashAPIKey reads a secret from the first line of stdin and prints its
+// credentials file form, for -hash-api-key.
+func runHashAPIKey() error {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return errors.New("no secret on stdin")
+	}
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		return errors.New("empty secret")
+	}
+	hash, err := hashAPIKeySecret(secret)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
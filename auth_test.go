@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testAPIKeys loads a credentials file for secrets, keyed by ID, hashed
+// at the minimum bcrypt cost to keep the tests fast.
+func testAPIKeys(t *testing.T, secrets map[string]string) *apiKeySet {
+	t.Helper()
+	entries := make(map[string]string, len(secrets))
+	for id, secret := range secrets {
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[id] = string(hash)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := loadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestAPIKeyCheck(t *testing.T) {
+	keys := testAPIKeys(t, map[string]string{"app": "s3cret"})
+	ip, now := "192.0.2.1", time.Now()
+	if role, err := keys.check(ip, "app", "s3cret", now); err != nil || role != RoleReadWrite {
+		t.Errorf("check(correct) = %q, %v", role, err)
+	}
+	if _, err := keys.check(ip, "app", "wrong", now); !errors.Is(err, errInvalidAPIKey) {
+		t.Errorf("check(wrong) = %v, want errInvalidAPIKey", err)
+	}
+	if _, err := keys.check(ip, "nobody", "s3cret", now); !errors.Is(err, errInvalidAPIKey) {
+		t.Errorf("check(unknown ID) = %v, want errInvalidAPIKey", err)
+	}
+}
+
+func TestAPIKeyFailureLimit(t *testing.T) {
+	keys := testAPIKeys(t, map[string]string{"app": "s3cret", "cached": "hunter2", "other": "pw"})
+	ip, now := "192.0.2.1", time.Now()
+	if _, err := keys.check(ip, "cached", "hunter2", now); err != nil {
+		t.Fatal(err)
+	}
+	for range authFailureLimit {
+		keys.check(ip, "app", "wrong", now)
+		keys.check(ip, "cached", "wrong", now)
+	}
+
+	if _, err := keys.check(ip, "app", "s3cret", now); !errors.Is(err, errTooManyAttempts) {
+		t.Errorf("check after %d failures = %v, want errTooManyAttempts", authFailureLimit, err)
+	}
+	if _, err := keys.check(ip, "cached", "hunter2", now); err != nil {
+		t.Errorf("a secret that matched before was refused over the limit: %v", err)
+	}
+	if _, err := keys.check(ip, "other", "pw", now); err != nil {
+		t.Errorf("failures for one ID locked out another: %v", err)
+	}
+	if _, err := keys.check("192.0.2.2", "app", "s3cret", now); err != nil {
+		t.Errorf("failures from one IP locked the ID out for another: %v", err)
+	}
+	if _, err := keys.check(ip, "app", "s3cret", now.Add(authFailureWindow)); err != nil {
+		t.Errorf("check after the window = %v, want success", err)
+	}
+}
+
+func TestAPIKeyUnknownIDsShareLimit(t *testing.T) {
+	keys := testAPIKeys(t, map[string]string{"app": "s3cret"})
+	ip, now := "192.0.2.1", time.Now()
+	for i := range authFailureLimit {
+		keys.check(ip, fmt.Sprintf("made-up-%d", i), "x", now)
+	}
+	if _, err := keys.check(ip, "yet-another", "x", now); !errors.Is(err, errTooManyAttempts) {
+		t.Errorf("fresh unknown ID = %v, want errTooManyAttempts", err)
+	}
+	if _, err := keys.check(ip, "app", "s3cret", now); err != nil {
+		t.Errorf("unknown ID failures locked out a real ID: %v", err)
+	}
+	if _, err := keys.check("192.0.2.2", "made-up", "x", now); !errors.Is(err, errInvalidAPIKey) {
+		t.Errorf("unknown ID from another IP = %v, want errInvalidAPIKey", err)
+	}
+}
+
+func TestAPIKeyFailuresSwept(t *testing.T) {
+	keys := testAPIKeys(t, map[string]string{"app": "s3cret"})
+	now := time.Now()
+	for i := range authFailureSweepSize {
+		keys.check(fmt.Sprintf("198.51.100.%d", i), "app", "wrong", now)
+	}
+	keys.check("192.0.2.1", "app", "wrong", now.Add(authFailureWindow))
+	if n := len(keys.failures); n != 1 {
+		t.Errorf("%d failure counts after the window, want 1", n)
+	}
+}
+
+func TestAuthMiddlewareTooManyAttempts(t *testing.T) {
+	var s apiKeyStore
+	s.Store(testAPIKeys(t, map[string]string{"app": "s3cret"}))
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	status := func(secret string) int {
+		req := httptest.NewRequest(http.MethodGet, "/count", nil)
+		req.RemoteAddr = "192.0.2.1:4321"
+		req.SetBasicAuth("app", secret)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for range authFailureLimit {
+		if code := status("wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong secret: status %d, want 401", code)
+		}
+	}
+	if code := status("s3cret"); code != http.StatusTooManyRequests {
+		t.Errorf("status %d over the limit, want 429", code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/count", nil)
+	req.RemoteAddr = "192.0.2.2:4321"
+	req.SetBasicAuth("app", "s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d from another address, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPrefix     = "kvstore-"
+	backupSuffix     = ".json"
+	backupTimeFormat = "20060102T150405.000Z"
+)
+
+// writeBackup writes a timestamped snapshot of the store into the backup
+// directory, in the same form as the data file and its metadata, and returns its
+// path. Both are copied under one read lock and written after it is
+// released.
+func (kvs *KeyValueStore) writeBackup(now time.Time) (string, error) {
+	if err := os.MkdirAll(kvs.cfg.BackupDir, 0o755); err != nil {
+		return "", err
+	}
+
+	kvs.mu.RLock()
+	store, meta := maps.Clone(kvs.store), kvs.snapshotMetaLocked()
+	kvs.mu.RUnlock()
+	data := snapshotData(store)
+
+	name := backupPrefix + now.UTC().Format(backupTimeFormat) + backupSuffix
+	path := filepath.Join(kvs.cfg.BackupDir, name)
+	if err := writeJSONFile(path, data, true); err != nil {
+		return "", err
+	}
+	if err := writeJSONFile(metaPathFor(path), meta, true); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// listBackups returns the backup files in the backup directory, oldest
+// first, leaving out their metadata files. The timestamp format sorts
+// lexically in chronological order.
+func (kvs *KeyValueStore) listBackups() ([]string, error) {
+	entries, err := os.ReadDir(kvs.cfg.BackupDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) && !strings.HasSuffix(name, metaSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// pruneBackups removes backups beyond the retention count and backups older
+// than the retention age. A zero limit disables that kind of pruning.
+func (kvs *KeyValueStore) pruneBackups(now time.Time) error {
+	names, err := kvs.listBackups()
+	if err != nil {
+		return err
+	}
+
+	keep := len(names)
+	if kvs.cfg.BackupRetainCount > 0 && keep > kvs.cfg.BackupRetainCount {
+		keep = kvs.cfg.BackupRetainCount
+	}
+
+	for i, name := range names {
+		expired := i < len(names)-keep
+		if !expired && kvs.cfg.BackupRetainAge > 0 {
+			stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix)
+			if taken, err := time.Parse(backupTimeFormat, stamp); err == nil {
+				expired = now.Sub(taken) > kvs.cfg.BackupRetainAge
+			}
+		}
+		if expired {
+			path := filepath.Join(kvs.cfg.BackupDir, name)
+			if err := os.Remove(path); err != nil {
+				log.Printf("Error removing old backup %s: %v", name, err)
+			}
+			if err := os.Remove(metaPathFor(path)); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error removing old backup metadata %s: %v", metaPathFor(path), err)
+			}
+		}
+	}
+	return nil
+}
+
+// startBackupRoutine writes a backup every BackupInterval until ctx is
+// cancelled. Failures (for example a full disk) are logged and the backup
+// is skipped; they never stop the server.
+func (kvs *KeyValueStore) startBackupRoutine(ctx context.Context) {
+	ticker := time.NewTicker(kvs.cfg.BackupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			path, err := kvs.writeBackup(now)
+			if err != nil {
+				log.Printf("Error writing backup, skipping: %v", err)
+				continue
+			}
+			log.Printf("Wrote backup %s", path)
+			if err := kvs.pruneBackups(now); err != nil {
+				log.Printf("Error pruning backups: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
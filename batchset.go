@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+const (
+	// batchSetChunk is how many entries /batch_set applies per write-lock
+	// acquisition, so readers are never blocked for the whole import.
+	batchSetChunk = 1000
+	// batchSetProgressEvery is how often, in entries, progress is logged.
+	batchSetProgressEvery = 100000
+)
+
+// Duplicate modes decide what a batch write naming the same key twice does.
+// /batch_set only compares keys within a chunk of batchSetChunk entries;
+// see BatchSet.
+const (
+	// DuplicatesReject fails the batch at the repeated key.
+	DuplicatesReject = "reject"
+	// DuplicatesLastWins applies entries in order, so the last one wins.
+	DuplicatesLastWins = "last-wins"
+)
+
+// ErrDuplicateKey is returned when a batch names a key more than once and
+// -batch-duplicates is reject.
+var ErrDuplicateKey = errors.New("duplicate key in batch")
+
+var (
+	errBatchNotArray   = errors.New("body must be a JSON array of {\"key\", \"value\"} objects")
+	errBatchMissingKey = errors.New("missing key")
+)
+
+type BatchSetEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type BatchSetResponse struct {
+	Status string `json:"status"`
+	Set    int    `json:"set"`
+}
+
+// BatchSetError reports a /batch_set that stopped partway. Entries before
+// the failing one have already been applied.
+type BatchSetError struct {
+	Applied int
+	Err     error
+}
+
+func (e *BatchSetError) Error() string {
+	return fmt.Sprintf("stopped after %d entries: %v", e.Applied, e.Err)
+}
+
+func (e *BatchSetError) Unwrap() error { return e.Err }
+
+// checkDuplicateKeys returns an ErrDuplicateKey for the first key in keys
+// that is already in seen, or that repeats within keys, adding the rest to
+// seen. It does nothing in last-wins mode. keys must be normalized.
+func (kvs *KeyValueStore) checkDuplicateKeys(seen map[string]bool, keys ...string) error {
+	if kvs.cfg.BatchDuplicates != DuplicatesReject {
+		return nil
+	}
+	for _, key := range keys {
+		if seen[key] {
+			return fmt.Errorf("%w: %q", ErrDuplicateKey, key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// setChunk writes entries under one write lock and returns how many were
+// applied before the first error.
+func (kvs *KeyValueStore) setChunk(entries []BatchSetEntry) (int, error) {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	for i, e := range entries {
+		if err := kvs.setLocked(kvs.normalizeKey(e.Key), e.Value); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// BatchSet streams a JSON array of entries from r and applies them in
+// chunks of batchSetChunk, so an import never holds more than one chunk in
+// memory and only takes the write lock briefly at a time. Unlike
+// /set_many_ttl it is not atomic: on a decode error, a rejected entry or
+// ctx being canceled it stops, and the entries already applied stay
+// written. The count applied is returned either way. In reject mode a key
+// repeated within one chunk stops the import there. Keys are only
+// remembered for the current chunk, so an import of any size needs memory
+// for one chunk's keys; a key repeated in a later chunk is applied again,
+// and the last value wins just as it would in last-wins mode.
+func (kvs *KeyValueStore) BatchSet(ctx context.Context, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return 0, errBatchNotArray
+	}
+
+	applied := 0
+	seen := make(map[string]bool, batchSetChunk)
+	chunk := make([]BatchSetEntry, 0, batchSetChunk)
+	flush := func() error {
+		n, err := kvs.setChunk(chunk)
+		applied += n
+		chunk = chunk[:0]
+		clear(seen)
+		if applied/batchSetProgressEvery > (applied-n)/batchSetProgressEvery {
+			log.Printf("batch_set: applied %d entries", applied)
+		}
+		return err
+	}
+
+	// stop applies whatever was decoded before err, so the entries written
+	// are always exactly those before the one that failed.
+	stop := func(err error) (int, error) {
+		if ferr := flush(); ferr != nil {
+			err = ferr
+		}
+		return applied, &BatchSetError{Applied: applied, Err: err}
+	}
+
+	for dec.More() {
+		if err := ctx.Err(); err != nil {
+			return stop(err)
+		}
+		var e BatchSetEntry
+		if err := dec.Decode(&e); err != nil {
+			return stop(err)
+		}
+		key := kvs.normalizeKey(e.Key)
+		if key == "" {
+			return stop(errBatchMissingKey)
+		}
+		if err := kvs.checkDuplicateKeys(seen, key); err != nil {
+			return stop(err)
+		}
+		chunk = append(chunk, e)
+		if len(chunk) == batchSetChunk {
+			if err := flush(); err != nil {
+				return applied, &BatchSetError{Applied: applied, Err: err}
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return stop(err)
+	}
+	if err := flush(); err != nil {
+		return applied, &BatchSetError{Applied: applied, Err: err}
+	}
+	return applied, nil
+}
+
+func (kvs *KeyValueStore) handleBatchSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	applied, err := kvs.BatchSet(r.Context(), r.Body)
+	if applied > 0 {
+		// Whatever was applied is kept, so save it even if the batch
+		// stopped early.
+		if err := kvs.persistWrite(r.Context()); err != nil {
+			log.Printf("Error saving to disk: %v", err)
+			kvs.sendInternalError(w, "Error saving to disk", err)
+			return
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	switch {
+	case err == nil:
+		sendJSONResponse(w, BatchSetResponse{Status: "OK", Set: applied}, http.StatusOK)
+	case errors.Is(err, context.Canceled):
+		log.Printf("batch_set canceled by client after %d entries", applied)
+	case errors.Is(err, errBatchMissingKey):
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, errBatchNotArray):
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: err.Error()}, http.StatusBadRequest)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: err.Error()}, http.StatusBadRequest)
+	default:
+		sendWriteError(w, err)
+	}
+}
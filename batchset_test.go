@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// batchBody encodes entries as a /batch_set body.
+func batchBody(t *testing.T, entries []BatchSetEntry) *strings.Reader {
+	t.Helper()
+	body, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.NewReader(string(body))
+}
+
+func TestBatchSetRejectsDuplicateKey(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	applied, err := kvs.BatchSet(context.Background(), batchBody(t, []BatchSetEntry{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "a", Value: "3"},
+		{Key: "c", Value: "4"},
+	}))
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("err = %v, want ErrDuplicateKey", err)
+	}
+	if applied != 2 {
+		t.Errorf("applied %d entries, want the 2 before the duplicate", applied)
+	}
+	if got, _ := kvs.Get("a"); got != "1" {
+		t.Errorf("a = %q, want the first value", got)
+	}
+	if _, ok := kvs.Get("c"); ok {
+		t.Error("entry after the duplicate was applied")
+	}
+}
+
+func TestBatchSetLastWins(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BatchDuplicates = DuplicatesLastWins
+	kvs := newTestStore(t, cfg)
+	applied, err := kvs.BatchSet(context.Background(), batchBody(t, []BatchSetEntry{
+		{Key: "a", Value: "1"},
+		{Key: "a", Value: "2"},
+	}))
+	if err != nil || applied != 2 {
+		t.Fatalf("BatchSet = %d, %v", applied, err)
+	}
+	if got, _ := kvs.Get("a"); got != "2" {
+		t.Errorf("a = %q, want the last value", got)
+	}
+}
+
+// TestBatchSetDuplicateAcrossChunks checks that only the current chunk's
+// keys are remembered: a key repeated in a later chunk is applied again.
+func TestBatchSetDuplicateAcrossChunks(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	entries := []BatchSetEntry{{Key: "a", Value: "first"}}
+	for i := 1; i < batchSetChunk; i++ {
+		entries = append(entries, BatchSetEntry{Key: "filler" + strconv.Itoa(i), Value: "v"})
+	}
+	entries = append(entries, BatchSetEntry{Key: "a", Value: "second"})
+
+	applied, err := kvs.BatchSet(context.Background(), batchBody(t, entries))
+	if err != nil || applied != len(entries) {
+		t.Fatalf("BatchSet = %d, %v; want all %d applied", applied, err, len(entries))
+	}
+	if got, _ := kvs.Get("a"); got != "second" {
+		t.Errorf("a = %q, want the later chunk's value", got)
+	}
+}
+
+func TestSetManyTTLRejectsDuplicateKey(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	err := kvs.SetManyTTL([]SetTTLEntry{{Key: "a", Value: "1"}, {Key: "a", Value: "2"}})
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("err = %v, want ErrDuplicateKey", err)
+	}
+	if _, ok := kvs.Get("a"); ok {
+		t.Error("a rejected batch wrote a key")
+	}
+}
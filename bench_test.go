@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// benchKeys is the size of the key space the benchmarks read and write.
+const benchKeys = 10000
+
+// benchStore returns a store preloaded with n keys, key0 to key(n-1).
+func benchStore(b *testing.B, n int) *KeyValueStore {
+	b.Helper()
+	kvs := newTestStore(b, testConfig(b))
+	for i := range n {
+		if err := kvs.Set("key"+strconv.Itoa(i), "value"+strconv.Itoa(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return kvs
+}
+
+func BenchmarkSet(b *testing.B) {
+	kvs := benchStore(b, 0)
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1)
+			if err := kvs.Set("key"+strconv.FormatInt(i%benchKeys, 10), "value"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	kvs := benchStore(b, benchKeys)
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1)
+			kvs.Get("key" + strconv.FormatInt(i%benchKeys, 10))
+		}
+	})
+}
+
+// BenchmarkConcurrentMixed runs nine reads for every write, a typical
+// cache-like workload, to show how writers hold up readers on kvs.mu.
+func BenchmarkConcurrentMixed(b *testing.B) {
+	kvs := benchStore(b, benchKeys)
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1)
+			key := "key" + strconv.FormatInt(i%benchKeys, 10)
+			if i%10 == 0 {
+				if err := kvs.Set(key, "value"); err != nil {
+					b.Error(err)
+					return
+				}
+			} else {
+				kvs.Get(key)
+			}
+		}
+	})
+}
+
+func BenchmarkSaveToDisk(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("keys=%d", n), func(b *testing.B) {
+			kvs := benchStore(b, n)
+			b.ResetTimer()
+			for range b.N {
+				// saveToDisk skips a clean store, so each iteration
+				// has to dirty it first.
+				kvs.mu.Lock()
+				kvs.dirty = true
+				kvs.mu.Unlock()
+				if err := kvs.saveToDisk(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidBit = errors.New("bit value must be 0 or 1")
+
+type SetBitRequest struct {
+	Key    string `json:"key"`
+	Offset int    `json:"offset"`
+	Value  int    `json:"value"`
+}
+
+type SetBitResponse struct {
+	Status   string `json:"status"`
+	Previous int    `json:"previous"`
+}
+
+type GetBitResponse struct {
+	Key    string `json:"key"`
+	Offset int    `json:"offset"`
+	Bit    int    `json:"bit"`
+}
+
+type BitCountResponse struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// bitAt returns the bit at offset in value, counting from the most
+// significant bit of the first byte as Redis does. Bits past the end are 0.
+func bitAt(value string, offset int) int {
+	i := offset / 8
+	if i >= len(value) {
+		return 0
+	}
+	return int(value[i]>>(7-offset%8)) & 1
+}
+
+// SetBit sets the bit at offset in key's value to bit and returns the bit's
+// previous value, like Redis SETBIT. The value is grown with zero bytes to
+// reach offset, and a missing key is treated as an empty value. The key
+// keeps its TTL and content type. The result is validated like any other
+// value, so bitmaps that aren't valid UTF-8 are refused under
+// -require-utf8; otherwise they are stored and persisted byte for byte.
+func (kvs *KeyValueStore) SetBit(key string, offset, bit int) (int, error) {
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	if bit != 0 && bit != 1 {
+		return 0, errInvalidBit
+	}
+	// As in SetRange, check the limit before growing the value.
+	if err := kvs.checkExtent(offset/8, 1); err != nil {
+		return 0, err
+	}
+	key = kvs.normalizeKey(key)
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	current, _ := kvs.lookupLocked(key, time.Now())
+	previous := bitAt(current, offset)
+	size := max(len(current), offset/8+1)
+	if previous == bit && size == len(current) {
+		return previous, nil
+	}
+
+	b := []byte(current)
+	if size > len(b) {
+		b = append(b, strings.Repeat("\x00", size-len(b))...)
+	}
+	mask := byte(1) << (7 - offset%8)
+	if bit == 1 {
+		b[offset/8] |= mask
+	} else {
+		b[offset/8] &^= mask
+	}
+	if err := kvs.updateLocked(key, string(b)); err != nil {
+		return 0, err
+	}
+	return previous, nil
+}
+
+// GetBit returns the bit at offset in key's value, or 0 if the key is
+// missing or the offset is past the end of the value.
+func (kvs *KeyValueStore) GetBit(key string, offset int) int {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	value, ok := kvs.lookupLocked(key, time.Now())
+	kvs.ops.gets.Add(1)
+	kvs.recordAccess(key, false)
+	if ok {
+		kvs.touchKey(key)
+	}
+	return bitAt(value, offset)
+}
+
+// BitCount returns the number of set bits in key's value, or 0 if the key
+// is missing.
+func (kvs *KeyValueStore) BitCount(key string) int {
+	return kvs.BitCountRange(key, 0, -1)
+}
+
+// BitCountRange counts the set bits in the bytes of key's value between
+// start and end inclusive, with indices handled as in GetRange.
+func (kvs *KeyValueStore) BitCountRange(key string, start, end int) int {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	value, ok := kvs.lookupLocked(key, time.Now())
+	kvs.ops.gets.Add(1)
+	kvs.recordAccess(key, false)
+	if !ok {
+		return 0
+	}
+	kvs.touchKey(key)
+
+	start, end = clampRange(len(value), start, end)
+	count := 0
+	for i := start; i < end; i++ {
+		count += bits.OnesCount8(value[i])
+	}
+	return count
+}
+
+func (kvs *KeyValueStore) handleSetBit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req SetBitRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if kvs.normalizeKey(req.Key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	previous, err := kvs.SetBit(req.Key, req.Offset, req.Value)
+	if errors.Is(err, errNegativeOffset) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid offset"}, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, errInvalidBit) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: err.Error()}, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, ErrValueTooLarge) {
+		// As for /setrange, an out-of-range offset is a bad request.
+		sendJSONResponse(w, ErrorResponse{Code: CodeValueTooLarge, Error: err.Error()}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, SetBitResponse{Status: "OK", Previous: previous}, http.StatusOK)
+}
+
+func (kvs *KeyValueStore) handleGetBit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid offset"}, http.StatusBadRequest)
+		return
+	}
+
+	sendJSONResponse(w, GetBitResponse{Key: kvs.normalizeKey(key), Offset: offset, Bit: kvs.GetBit(key, offset)}, http.StatusOK)
+}
+
+func (kvs *KeyValueStore) handleBitCount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	start, end, ok := parseRangeParams(w, r)
+	if !ok {
+		return
+	}
+
+	sendJSONResponse(w, BitCountResponse{Key: kvs.normalizeKey(key), Count: kvs.BitCountRange(key, start, end)}, http.StatusOK)
+}
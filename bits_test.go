@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// setHighBits sets bits that leave key's value invalid UTF-8 and returns
+// the value.
+func setHighBits(t *testing.T, kvs *KeyValueStore, key string) string {
+	t.Helper()
+	for _, offset := range []int{0, 7, 8, 9, 23} {
+		if _, err := kvs.SetBit(key, offset, 1); err != nil {
+			t.Fatalf("SetBit(%d): %v", offset, err)
+		}
+	}
+	return "\x81\xc0\x01"
+}
+
+func TestSetBitSurvivesSnapshot(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MirrorFile = filepath.Join(cfg.DataDir, "mirror.json")
+	kvs := newTestStore(t, cfg)
+	want := setHighBits(t, kvs, "bitmap")
+	if err := kvs.Set("text", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatalf("saveToDisk: %v", err)
+	}
+
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("bitmap"); got != want {
+		t.Errorf("after reload bitmap = %q, want %q", got, want)
+	}
+	if got, _ := kvs.Get("text"); got != "plain" {
+		t.Errorf("after reload text = %q, want %q", got, "plain")
+	}
+	if n := kvs.BitCount("bitmap"); n != 5 {
+		t.Errorf("BitCount = %d, want 5", n)
+	}
+
+	if err := os.WriteFile(kvs.dataPath(), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("bitmap"); got != want {
+		t.Errorf("after loading the mirror bitmap = %q, want %q", got, want)
+	}
+}
+
+func TestSetBitSurvivesWALReplay(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.WAL = true
+	kvs := newTestStore(t, cfg)
+	want := setHighBits(t, kvs, "bitmap")
+
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("bitmap"); got != want {
+		t.Errorf("after replay bitmap = %q, want %q", got, want)
+	}
+}
+
+func TestSetBitWithRequireUTF8(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RequireUTF8 = true
+	kvs := newTestStore(t, cfg)
+
+	// 0x40 alone is ASCII, so the first bit is accepted; setting the top
+	// bit makes 0xc0, which can't start valid UTF-8 on its own.
+	if _, err := kvs.SetBit("bitmap", 1, 1); err != nil {
+		t.Fatalf("SetBit to a valid byte: %v", err)
+	}
+	if _, err := kvs.SetBit("bitmap", 0, 1); !errors.Is(err, ErrValueNotUTF8) {
+		t.Errorf("SetBit to an invalid byte: %v, want ErrValueNotUTF8", err)
+	}
+	if got, _ := kvs.Get("bitmap"); got != "@" {
+		t.Errorf("bitmap = %q after the rejected SetBit, want %q", got, "@")
+	}
+}
+
+func TestSetBitOffsetLimit(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	for _, offset := range []int{8 * maxValueExtent, math.MaxInt - 7, math.MaxInt} {
+		if _, err := kvs.SetBit("bitmap", offset, 1); !errors.Is(err, ErrValueTooLarge) {
+			t.Errorf("SetBit at offset %d: %v, want ErrValueTooLarge", offset, err)
+		}
+	}
+	if _, ok := kvs.Get("bitmap"); ok {
+		t.Error("a rejected SetBit created the key")
+	}
+
+	body := `{"key":"bitmap","offset":` + strconv.Itoa(math.MaxInt-7) + `,"value":1}`
+	rec := serve(kvs.handleSetBit, http.MethodPost, "/setbit", body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeValueTooLarge) {
+		t.Errorf("/setbit at MaxInt-7: status %d: %s, want 400 %s", rec.Code, rec.Body, CodeValueTooLarge)
+	}
+
+	cfg := testConfig(t)
+	cfg.MaxValueBytes = 2
+	kvs = newTestStore(t, cfg)
+	if _, err := kvs.SetBit("bitmap", 15, 1); err != nil {
+		t.Errorf("SetBit in the last allowed byte: %v", err)
+	}
+	if _, err := kvs.SetBit("bitmap", 16, 1); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("SetBit past -max-value-bytes: %v, want ErrValueTooLarge", err)
+	}
+}
+
+func TestGetEncodesBinaryValues(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	setHighBits(t, kvs, "bitmap")
+
+	rec := serve(kvs.handleGet, http.MethodGet, "/get?key=bitmap", "")
+	var resp GetResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if resp.Encoding != encodingBase64 || resp.Value != "gcAB" {
+		t.Errorf("got value %q encoding %q, want %q base64", resp.Value, resp.Encoding, "gcAB")
+	}
+}
+
+// TestSnapshotEncodingSurvivesStaleMeta saves a binary value, then replaces
+// it with text that happens to be valid base64 and saves again, keeping the
+// first save's metadata as a crash between the two renames would. The text
+// must load as written, since the encoding travels with the value.
+func TestSnapshotEncodingSurvivesStaleMeta(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	setHighBits(t, kvs, "k")
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(kvs.dataPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"k":{"encoding":"base64","value":"gcAB"}}`; strings.TrimSpace(string(data)) != want {
+		t.Errorf("data file = %s, want %s", data, want)
+	}
+	staleMeta, err := os.ReadFile(kvs.metaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kvs.Set("k", "aGVsbG8="); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kvs.metaPath(), staleMeta, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("k"); got != "aGVsbG8=" {
+		t.Errorf("k = %q after loading with stale metadata, want aGVsbG8=", got)
+	}
+}
+
+func TestDecodeSnapshotRejectsBadTags(t *testing.T) {
+	for _, data := range []string{
+		`{"k":{"encoding":"rot13","value":"x"}}`,
+		`{"k":{"encoding":"base64","value":"!!"}}`,
+		`{"k":1}`,
+	} {
+		if err := decodeSnapshot([]byte(data), map[string]string{}); err == nil {
+			t.Errorf("decodeSnapshot(%s) succeeded", data)
+		}
+	}
+}
+
+// TestEndpointsEncodeBinaryValues reads a SetBit-produced value back from
+// every endpoint that returns values. Each must send it base64-encoded with
+// its encoding named, rather than letting encoding/json replace the invalid
+// bytes with U+FFFD.
+func TestEndpointsEncodeBinaryValues(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HistorySize = 4
+	cfg.IndexValues = true
+	kvs := newTestStore(t, cfg)
+	want := setHighBits(t, kvs, "bitmap")
+
+	watch := httptest.NewRequest(http.MethodGet, "/watch?key=bitmap", nil)
+	watch.Header.Set("If-None-Match", `"stale"`)
+	tests := []struct {
+		name string
+		req  *http.Request
+		h    http.HandlerFunc
+	}{
+		{"/get", httptest.NewRequest(http.MethodGet, "/get?key=bitmap", nil), kvs.handleGet},
+		{"/dump", httptest.NewRequest(http.MethodGet, "/dump", nil), kvs.handleDump},
+		{"/consistent_get", httptest.NewRequest(http.MethodPost, "/consistent_get", strings.NewReader(`{"keys":["bitmap"]}`)), kvs.handleConsistentGet},
+		{"/debug/keys", httptest.NewRequest(http.MethodGet, "/debug/keys?values=true", nil), kvs.handleSampleKeys},
+		{"/txn", httptest.NewRequest(http.MethodPost, "/txn", strings.NewReader(`{"ops":[{"op":"get","key":"bitmap"}]}`)), kvs.handleTxn},
+		{"/history", httptest.NewRequest(http.MethodGet, "/history?key=bitmap", nil), kvs.handleHistory},
+		{"/watch", watch, kvs.handleWatch},
+		{"/getrange", httptest.NewRequest(http.MethodGet, "/getrange?key=bitmap", nil), kvs.handleGetRange},
+		{"/find_by_value", httptest.NewRequest(http.MethodGet, "/find_by_value?value="+url.QueryEscape(want), nil), kvs.handleFindByValue},
+		// Last, since it replaces the bitmap.
+		{"/set?return_old", httptest.NewRequest(http.MethodPost, "/set?return_old=true", strings.NewReader(`{"key":"bitmap","value":"text"}`)), kvs.handleSet},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.h(rec, tt.req)
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", tt.name, rec.Code, body)
+			continue
+		}
+		if !strings.Contains(body, `"gcAB"`) || !strings.Contains(body, `"`+encodingBase64+`"`) {
+			t.Errorf("%s: %s, want the value base64-encoded as gcAB with its encoding", tt.name, body)
+		}
+		if strings.Contains(body, "\ufffd") || strings.Contains(body, `\ufffd`) {
+			t.Errorf("%s: %s carries U+FFFD", tt.name, body)
+		}
+	}
+}
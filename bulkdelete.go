@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+type BulkDeleteResponse struct {
+	Status   string `json:"status"`
+	Deleted  int    `json:"deleted"`
+	NotFound int    `json:"not_found"`
+}
+
+// BulkDelete removes keys under one write lock, so readers see either all
+// of them or none, and returns how many existed and how many did not. A key
+// listed twice counts as not found the second time.
+func (kvs *KeyValueStore) BulkDelete(keys []string) (deleted, notFound int) {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		key = kvs.normalizeKey(key)
+		// As with Delete, an expired key that hasn't been swept yet is
+		// removed but reported as missing.
+		expired := kvs.expiries.expired(key, now)
+		if kvs.deleteLocked(key) && !expired {
+			deleted++
+		} else {
+			notFound++
+		}
+	}
+	return deleted, notFound
+}
+
+func (kvs *KeyValueStore) handleBulkDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	if err := json.Unmarshal(body, &keys); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+	for _, key := range keys {
+		if kvs.normalizeKey(key) == "" {
+			sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	deleted, notFound := kvs.BulkDelete(keys)
+	if deleted > 0 {
+		if err := kvs.persistWrite(r.Context()); err != nil {
+			log.Printf("Error saving to disk: %v", err)
+			kvs.sendInternalError(w, "Error saving to disk", err)
+			return
+		}
+	}
+	sendJSONResponse(w, BulkDeleteResponse{Status: "OK", Deleted: deleted, NotFound: notFound}, http.StatusOK)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpiresAt returns when key expires, if it has a TTL.
+func (kvs *KeyValueStore) ExpiresAt(key string) (time.Time, bool) {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	return kvs.expiries.get(key)
+}
+
+// cacheControl returns the Cache-Control header for a read of key, or ""
+// when caching headers are off. With -cache-control-ttl, a key's remaining
+// TTL replaces any max-age in -cache-control so caches drop the entry when
+// the store does.
+func (kvs *KeyValueStore) cacheControl(key string) string {
+	base := kvs.cfg.CacheControl
+	if !kvs.cfg.CacheControlTTL {
+		return base
+	}
+	at, ok := kvs.ExpiresAt(key)
+	if !ok {
+		return base
+	}
+
+	remaining := int64(time.Until(at) / time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	directives := []string{"max-age=" + strconv.FormatInt(remaining, 10)}
+	for _, d := range strings.Split(base, ",") {
+		d = strings.TrimSpace(d)
+		name, _, _ := strings.Cut(strings.ToLower(d), "=")
+		if d == "" || name == "max-age" || name == "s-maxage" {
+			continue
+		}
+		directives = append(directives, d)
+	}
+	return strings.Join(directives, ", ")
+}
+
+// setCacheHeaders adds the configured Cache-Control header, if any, to a
+// successful read of key.
+func (kvs *KeyValueStore) setCacheHeaders(w http.ResponseWriter, key string) {
+	if cc := kvs.cacheControl(key); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// changeLogBuffer is how many events can be queued before new ones are
+// dropped.
+const changeLogBuffer = 8192
+
+// ChangeEvent is one line of the -change-log stream.
+type ChangeEvent struct {
+	Op  string    `json:"op"`
+	Key string    `json:"key"`
+	TS  time.Time `json:"ts"`
+}
+
+// changeLog writes change events to an io.Writer from its own goroutine.
+// The write path only does a non-blocking channel send, so a slow reader
+// on the other end of stdout costs dropped events, never slower writes.
+type changeLog struct {
+	events  chan ChangeEvent
+	dropped atomic.Uint64
+}
+
+func newChangeLog(w io.Writer) *changeLog {
+	cl := &changeLog{events: make(chan ChangeEvent, changeLogBuffer)}
+	go cl.run(w)
+	return cl
+}
+
+func (cl *changeLog) emit(op, key string) {
+	select {
+	case cl.events <- ChangeEvent{Op: op, Key: key, TS: time.Now().UTC()}:
+	default:
+		if cl.dropped.Add(1) == 1 {
+			log.Printf("Change log is falling behind; dropping events")
+		}
+	}
+}
+
+// run encodes events as they arrive and flushes whenever the queue drains,
+// so bursts are written in large chunks without delaying a lone event.
+func (cl *changeLog) run(w io.Writer) {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	for ev := range cl.events {
+		enc.Encode(ev)
+		if len(cl.events) == 0 {
+			buf.Flush()
+		}
+	}
+}
+
+// recordChange emits a change event when -change-log is set.
+func (kvs *KeyValueStore) recordChange(op, key string) {
+	if kvs.changes != nil {
+		kvs.changes.emit(op, key)
+	}
+}
+
+// changesDropped returns how many change events were dropped because the
+// queue was full.
+func (kvs *KeyValueStore) changesDropped() uint64 {
+	if kvs.changes == nil {
+		return 0
+	}
+	return kvs.changes.dropped.Load()
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrNotFound is returned when the requested key does not exist.
+var ErrNotFound = errors.New("key not found")
+
+// APIError is an error response from the server.
+type APIError struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("server returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client talks to a single key-value store server over its HTTP API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// New returns a client for the server at baseURL, e.g.
+// "http://localhost:8080". If httpClient is nil, http.DefaultClient is used.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Set stores value under key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	body := map[string]string{"key": key, "value": value}
+	return c.do(ctx, http.MethodPost, "/set", nil, body, nil)
+}
+
+// Get returns the value stored under key, or ErrNotFound. A key holding the
+// empty string returns "" and a nil error. A value that isn't valid UTF-8
+// arrives base64-encoded and is returned decoded.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	var resp struct {
+		Value    string `json:"value"`
+		Encoding string `json:"encoding"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/get", url.Values{"key": {key}}, nil, &resp); err != nil {
+		return "", err
+	}
+	value, err := decodeValue(resp.Value, resp.Encoding)
+	if err != nil {
+		return "", fmt.Errorf("decoding value of %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// decodeValue undoes the encoding the server applies to values that aren't
+// valid UTF-8.
+func decodeValue(value, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return value, nil
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(value)
+		return string(b), err
+	default:
+		return "", fmt.Errorf("unknown value encoding %q", encoding)
+	}
+}
+
+// Delete removes key, returning ErrNotFound if it did not exist.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	body := map[string]string{"key": key}
+	return c.do(ctx, http.MethodPost, "/delete", nil, body, nil)
+}
+
+// Count returns the number of keys in the store.
+func (c *Client) Count(ctx context.Context) (int, error) {
+	var resp struct {
+		Count int `json:"count"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/count", nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// Dump returns every key/value pair whose key starts with prefix. An empty
+// prefix returns the whole store. Values that aren't valid UTF-8 arrive as
+// {"encoding", "value"} objects and are returned decoded.
+func (c *Client) Dump(ctx context.Context, prefix string) (map[string]string, error) {
+	var query url.Values
+	if prefix != "" {
+		query = url.Values{"prefix": {prefix}}
+	}
+	var resp map[string]json.RawMessage
+	if err := c.do(ctx, http.MethodGet, "/dump", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(resp))
+	for key, raw := range resp {
+		var tagged struct {
+			Value    string `json:"value"`
+			Encoding string `json:"encoding"`
+		}
+		if err := json.Unmarshal(raw, &tagged.Value); err != nil {
+			if err := json.Unmarshal(raw, &tagged); err != nil {
+				return nil, fmt.Errorf("decoding value of %q: %w", key, err)
+			}
+		}
+		value, err := decodeValue(tagged.Value, tagged.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("decoding value of %q: %w", key, err)
+		}
+		data[key] = value
+	}
+	return data, nil
+}
+
+// do sends a request with an optional JSON body and decodes a successful
+// JSON response into out, if out is non-nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
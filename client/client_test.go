@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetAndDumpDecodeBinaryValues(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/get":
+			w.Write([]byte(`{"key":"bitmap","value":"gcAB","encoding":"base64","found":true}`))
+		case "/dump":
+			w.Write([]byte(`{"bitmap":{"encoding":"base64","value":"gcAB"},"text":"plain"}`))
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL, nil)
+	ctx := context.Background()
+
+	if got, err := c.Get(ctx, "bitmap"); err != nil || got != "\x81\xc0\x01" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	data, err := c.Dump(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["bitmap"] != "\x81\xc0\x01" || data["text"] != "plain" || len(data) != 2 {
+		t.Errorf("Dump = %q", data)
+	}
+}
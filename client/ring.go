@@ -0,0 +1,70 @@
+// Package client provides helpers for talking to one or more key-value
+// store servers.
+package client
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// TotalSlots is the number of hash slots the key space is divided into.
+// Servers report their assignment in terms of these slots on /shard_info.
+const TotalSlots = 16384
+
+// KeySlot returns the hash slot that key belongs to. It must stay in sync
+// with keySlot in the server.
+func KeySlot(key string) int {
+	return int(crc32.ChecksumIEEE([]byte(key)) % TotalSlots)
+}
+
+// DefaultReplicas is the number of virtual points each node gets on a Ring.
+// More points spread keys more evenly at the cost of a larger ring.
+const DefaultReplicas = 128
+
+// Ring routes keys to nodes with consistent hashing, so adding or removing
+// a node only moves the keys that hashed to it. A Ring is immutable and
+// safe for concurrent use. It knows nothing of the slots servers are
+// assigned with -shard-slots, so it only suits servers left owning every
+// slot; against a slot-assigned cluster use a SlotMap.
+type Ring struct {
+	points []uint32
+	owners map[uint32]string
+}
+
+// NewRing builds a ring over nodes (typically server base URLs), placing
+// replicas virtual points per node. If replicas is not positive,
+// DefaultReplicas is used.
+func NewRing(nodes []string, replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	r := &Ring{owners: make(map[uint32]string, len(nodes)*replicas)}
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			point := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(i)))
+			if _, taken := r.owners[point]; taken {
+				continue
+			}
+			r.owners[point] = node
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Node returns the node responsible for key, or "" if the ring is empty.
+func (r *Ring) Node(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// SlotRange is an inclusive range of hash slots.
+type SlotRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// ShardInfo is a server's slot assignment, as reported on /shard_info.
+type ShardInfo struct {
+	NodeID     string      `json:"node_id"`
+	TotalSlots int         `json:"total_slots"`
+	Slots      []SlotRange `json:"slots"`
+}
+
+// ShardInfo returns the hash slots the server is configured to own.
+func (c *Client) ShardInfo(ctx context.Context) (ShardInfo, error) {
+	var info ShardInfo
+	if err := c.do(ctx, http.MethodGet, "/shard_info", nil, nil, &info); err != nil {
+		return ShardInfo{}, err
+	}
+	return info, nil
+}
+
+// SlotMap routes keys to nodes by the hash slots each node reports owning
+// on /shard_info, so it always agrees with the servers' -shard-slots
+// assignment. A SlotMap is immutable and safe for concurrent use; build a
+// new one when the assignment changes.
+type SlotMap struct {
+	nodes  []string
+	owners [TotalSlots]int
+}
+
+// NewSlotMap asks each of nodes (server base URLs) for its slot assignment
+// and builds the routing table. Every slot must be owned by exactly one
+// node: a slot claimed twice or not at all is an error, since keys in it
+// would be routed inconsistently or nowhere. If httpClient is nil,
+// http.DefaultClient is used.
+func NewSlotMap(ctx context.Context, nodes []string, httpClient *http.Client) (*SlotMap, error) {
+	m := &SlotMap{nodes: nodes}
+	for i := range m.owners {
+		m.owners[i] = -1
+	}
+	for i, node := range nodes {
+		info, err := New(node, httpClient).ShardInfo(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fetching slots of %s: %w", node, err)
+		}
+		if info.TotalSlots != TotalSlots {
+			return nil, fmt.Errorf("%s divides keys into %d slots, not %d", node, info.TotalSlots, TotalSlots)
+		}
+		for _, r := range info.Slots {
+			if r.Start < 0 || r.End < r.Start || r.End >= TotalSlots {
+				return nil, fmt.Errorf("%s reports invalid slot range %d-%d", node, r.Start, r.End)
+			}
+			for slot := r.Start; slot <= r.End; slot++ {
+				if owner := m.owners[slot]; owner >= 0 && owner != i {
+					return nil, fmt.Errorf("slot %d is claimed by both %s and %s", slot, nodes[owner], node)
+				}
+				m.owners[slot] = i
+			}
+		}
+	}
+	for slot, owner := range m.owners {
+		if owner < 0 {
+			return nil, fmt.Errorf("slot %d is not owned by any node", slot)
+		}
+	}
+	return m, nil
+}
+
+// Node returns the node that owns key's slot. Servers hash keys after
+// normalizing them, so against servers run with -normalize-keys or
+// -lowercase-keys pass the key in its normalized form.
+func (m *SlotMap) Node(key string) string {
+	return m.nodes[m.owners[KeySlot(key)]]
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// shardServer serves /shard_info for a node owning slots.
+func shardServer(t *testing.T, slots ...SlotRange) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ShardInfo{TotalSlots: TotalSlots, Slots: slots})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestSlotMapRoutesBySlot(t *testing.T) {
+	low := shardServer(t, SlotRange{0, 8191})
+	high := shardServer(t, SlotRange{8192, 16383})
+	m, err := NewSlotMap(context.Background(), []string{low, high}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "user:1", "user:2", "x"} {
+		want := low
+		if KeySlot(key) >= 8192 {
+			want = high
+		}
+		if got := m.Node(key); got != want {
+			t.Errorf("Node(%q) with slot %d = %s, want %s", key, KeySlot(key), got, want)
+		}
+	}
+}
+
+func TestSlotMapRejectsBadAssignments(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		want  string
+	}{
+		{"overlap", []string{shardServer(t, SlotRange{0, 16383}), shardServer(t, SlotRange{100, 200})}, "claimed by both"},
+		{"gap", []string{shardServer(t, SlotRange{0, 100}), shardServer(t, SlotRange{102, 16383})}, "slot 101 is not owned"},
+	}
+	for _, tt := range tests {
+		_, err := NewSlotMap(context.Background(), tt.nodes, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TypedStore wraps a Client so values of type T are stored as their JSON
+// encoding, sparing callers the marshaling at every call site. Keys written
+// through the plain Client remain readable here as long as they hold valid
+// JSON for T.
+type TypedStore[T any] struct {
+	c *Client
+}
+
+// NewTypedStore returns a TypedStore that reads and writes through c.
+func NewTypedStore[T any](c *Client) *TypedStore[T] {
+	return &TypedStore[T]{c: c}
+}
+
+// Set stores the JSON encoding of value under key.
+func (s *TypedStore[T]) Set(ctx context.Context, key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding value for %q: %w", key, err)
+	}
+	return s.c.Set(ctx, key, string(data))
+}
+
+// Get decodes the value stored under key, returning ErrNotFound if it does
+// not exist or an error if it isn't valid JSON for T.
+func (s *TypedStore[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+	raw, err := s.c.Get(ctx, key)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return value, fmt.Errorf("decoding value of %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// Delete removes key, returning ErrNotFound if it did not exist.
+func (s *TypedStore[T]) Delete(ctx context.Context, key string) error {
+	return s.c.Delete(ctx, key)
+}
@@ -0,0 +1,97 @@
+// Command kvctl is a small command-line client for the key-value store.
+//
+// Usage:
+//
+//	kvctl [-addr URL] set KEY VALUE
+//	kvctl [-addr URL] get KEY
+//	kvctl [-addr URL] del KEY
+//	kvctl [-addr URL] count
+//	kvctl [-addr URL] dump [PREFIX]
+//
+// The server address defaults to $KVCTL_ADDR, or http://localhost:8080.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/razamobin/go-key-value-store/client"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: kvctl [-addr URL] set KEY VALUE | get KEY | del KEY | count | dump [PREFIX]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	defaultAddr := os.Getenv("KVCTL_ADDR")
+	if defaultAddr == "" {
+		defaultAddr = "http://localhost:8080"
+	}
+	addr := flag.String("addr", defaultAddr, "server base URL (or set KVCTL_ADDR)")
+	timeout := flag.Duration("timeout", 10*time.Second, "request timeout")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if err := run(ctx, client.New(*addr, nil), args); err != nil {
+		if errors.Is(err, client.ErrNotFound) {
+			fmt.Fprintln(os.Stderr, "kvctl: key not found")
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "kvctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, c *client.Client, args []string) error {
+	cmd, args := args[0], args[1:]
+	switch {
+	case cmd == "set" && len(args) == 2:
+		return c.Set(ctx, args[0], args[1])
+	case cmd == "get" && len(args) == 1:
+		value, err := c.Get(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case cmd == "del" && len(args) == 1:
+		return c.Delete(ctx, args[0])
+	case cmd == "count" && len(args) == 0:
+		count, err := c.Count(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(count)
+		return nil
+	case cmd == "dump" && len(args) <= 1:
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		data, err := c.Dump(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	default:
+		usage()
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+)
+
+type CompactResponse struct {
+	BytesBefore    int64 `json:"bytes_before"`
+	BytesAfter     int64 `json:"bytes_after"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+}
+
+// Compact rewrites the data file from the in-memory store even if nothing
+// has changed since the last save, and reports the file size before and
+// after.
+func (kvs *KeyValueStore) Compact() (CompactResponse, error) {
+	kvs.saveMu.Lock()
+	defer kvs.saveMu.Unlock()
+
+	var resp CompactResponse
+	if info, err := os.Stat(kvs.dataPath()); err == nil {
+		resp.BytesBefore = info.Size()
+	} else if !os.IsNotExist(err) {
+		return resp, err
+	}
+
+	kvs.mu.Lock()
+	kvs.dirty = true
+	kvs.mu.Unlock()
+
+	if err := kvs.writeSnapshot(); err != nil {
+		return resp, err
+	}
+
+	info, err := os.Stat(kvs.dataPath())
+	if err != nil {
+		return resp, err
+	}
+	resp.BytesAfter = info.Size()
+	if resp.BytesBefore > resp.BytesAfter {
+		resp.BytesReclaimed = resp.BytesBefore - resp.BytesAfter
+	}
+	return resp, nil
+}
+
+func (kvs *KeyValueStore) handleCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	resp, err := kvs.Compact()
+	if err != nil {
+		log.Printf("Error compacting data file: %v", err)
+		kvs.sendInternalError(w, "Error compacting data file", err)
+		return
+	}
+	sendJSONResponse(w, resp, http.StatusOK)
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Fsync policies trade durability for write throughput:
+//
+//   - always:   every acknowledged write is saved and fsynced before the
+//     response is sent. Nothing acknowledged is lost on a crash, but each
+//     write pays for a full snapshot.
+//   - interval: writes are saved by the sync routine every -sync-interval.
+//     A crash can lose up to one interval of writes. This is the default.
+//   - never:    snapshots are written on the same schedule but never
+//     fsynced, leaving flushing to the OS. Fastest, but a power loss can
+//     lose or truncate recent snapshots.
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+)
+
+// Config holds the runtime options that can be set from the command line.
+type Config struct {
+	// NormalizeKeys trims leading and trailing whitespace from every key.
+	NormalizeKeys bool
+	// LowercaseKeys folds every key to lower case, making lookups
+	// case-insensitive.
+	LowercaseKeys bool
+
+	// BackupInterval is how often a timestamped backup is written to
+	// BackupDir. Zero disables periodic backups.
+	BackupInterval time.Duration
+	BackupDir      string
+	// BackupRetainCount and BackupRetainAge bound how many backups are
+	// kept and for how long. Zero means no limit.
+	BackupRetainCount int
+	BackupRetainAge   time.Duration
+
+	// FlushSchedules deletes key prefixes on cron schedules, e.g. clearing
+	// "daily:" at midnight.
+	FlushSchedules flushScheduleFlag
+
+	// TrackAccess enables per-key read/write counters for /hotkeys.
+	// AccessTrackerSize bounds how many distinct keys are counted.
+	TrackAccess       bool
+	AccessTrackerSize int
+
+	// FsyncPolicy is one of FsyncAlways, FsyncInterval or FsyncNever.
+	FsyncPolicy string
+	// DataDir holds DataFile, its metadata file and the lock file. WALDir
+	// holds walFile and defaults to DataDir; backups go to BackupDir.
+	DataDir  string
+	DataFile string
+	WALDir   string
+	// SyncInterval is how often the sync routine saves unsaved writes.
+	SyncInterval time.Duration
+	// MirrorFile, if set, is a second copy of the data file, with its
+	// metadata beside it as for the data file, written on every snapshot
+	// and loaded when the data file is missing, unreadable or corrupt.
+	MirrorFile string
+	// WAL appends every write to walFile between snapshots. With
+	// FsyncAlways, a write is acknowledged once its log record is fsynced
+	// instead of after a full snapshot.
+	WAL bool
+
+	// PrefixQuotas maps a key prefix to the maximum number of keys allowed
+	// under it.
+	PrefixQuotas map[string]int
+
+	// H2C accepts HTTP/2 with prior knowledge on cleartext connections,
+	// alongside HTTP/1.1.
+	H2C bool
+
+	// PprofAddr, when set, serves net/http/pprof on a separate listener.
+	PprofAddr string
+
+	// CredentialsFile, when set, names a JSON file of API key IDs and
+	// hashed secrets; every request except /health must present one.
+	// HashAPIKey prints the hash of a secret read from stdin and exits.
+	CredentialsFile string
+	HashAPIKey      bool
+
+	// ShardNodeID and ShardSlots describe this node's place in a
+	// client-side sharded cluster; they are only reported, not enforced.
+	ShardNodeID string
+	ShardSlots  []SlotRange
+
+	// IdleTimeout closes keep-alive connections that sit idle this long.
+	// DisableKeepAlives closes every connection after one request.
+	// TCPKeepAlive is the TCP keep-alive probe period for accepted
+	// connections; negative disables probes.
+	IdleTimeout       time.Duration
+	DisableKeepAlives bool
+	TCPKeepAlive      time.Duration
+	// VerboseErrors includes the underlying error in responses to internal
+	// failures instead of only a generic message.
+	VerboseErrors bool
+	// MaxConnsPerIP caps concurrent HTTP connections from one source IP;
+	// zero means no cap.
+	MaxConnsPerIP int
+
+	// SeedFile is a JSON object of defaults merged in after loading
+	// the data file; SeedOverwrite lets it replace values already present.
+	SeedFile      string
+	SeedOverwrite bool
+
+	// InitialCapacity pre-sizes the key map so a store known to grow large
+	// doesn't rehash repeatedly under the write lock while it fills up.
+	InitialCapacity int
+
+	// MaxKeys caps the number of keys (zero for no cap); OverflowMode
+	// picks what happens to a new key at the cap.
+	MaxKeys      int
+	OverflowMode string
+
+	// MaxTTL caps any TTL a request sets (zero for no cap); MaxTTLMode
+	// picks whether a longer TTL is clamped or rejected.
+	MaxTTL     time.Duration
+	MaxTTLMode string
+
+	// BatchDuplicates is DuplicatesReject or DuplicatesLastWins, for
+	// /batch_set and /set_many_ttl requests that repeat a key. /batch_set
+	// streams, so it only rejects keys repeated within one chunk.
+	BatchDuplicates string
+
+	// IndexValues maintains a value -> keys index for /find_by_value.
+	IndexValues bool
+
+	// HistorySize is how many recent values to keep per key for /history;
+	// zero disables history.
+	HistorySize int
+
+	// MaxKeyBytes and MaxValueBytes cap the size of stored keys and
+	// values; zero disables a limit.
+	MaxKeyBytes   int
+	MaxValueBytes int
+	// RequireUTF8 rejects values that aren't valid UTF-8.
+	RequireUTF8 bool
+
+	// MinSaveInterval is the least time between the starts of two saves;
+	// saves requested sooner are coalesced. Zero saves on every request.
+	MinSaveInterval time.Duration
+
+	// ChangeLog writes a JSON line to stdout for every set and delete.
+	ChangeLog bool
+
+	// SlowThreshold logs requests that take longer than this; zero turns
+	// the log off.
+	SlowThreshold time.Duration
+
+	// CacheControl is sent as the Cache-Control header on /get and /raw
+	// hits. CacheControlTTL sets max-age from a key's remaining TTL.
+	// Both off sends no caching headers.
+	CacheControl    string
+	CacheControlTTL bool
+
+	// HTTPAddr and TCPAddr are the listen addresses of the API and the
+	// shutdown listener. IPv6 hosts must be bracketed, e.g. [::1]:8080.
+	HTTPAddr string
+	TCPAddr  string
+
+	// ShutdownTimeout bounds how long shutdown waits for in-flight
+	// requests before closing their connections.
+	ShutdownTimeout time.Duration
+
+	// Expvar exposes operation counters at /debug/vars.
+	Expvar bool
+
+	// KeyPattern, if set, must match every written key in full.
+	// KeyPatternReads applies the same check to reads.
+	KeyPattern       *regexp.Regexp
+	KeyPatternSource string
+	KeyPatternReads  bool
+
+	// InternValues makes keys with identical values share one copy.
+	InternValues bool
+
+	// ConfigFile is a JSON object of flag names to values, applied at
+	// startup and re-read on SIGHUP. Flags given on the command line or
+	// through KVSTORE_ environment variables take precedence over it;
+	// explicitFlags records which those were.
+	ConfigFile    string
+	explicitFlags map[string]bool
+}
+
+// readConfigFile reads a -config file into flag name/value pairs. Values
+// may be JSON strings, numbers or booleans.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	settings := make(map[string]string, len(raw))
+	for name, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		settings[strings.TrimPrefix(name, "-")] = s
+	}
+	if _, ok := settings["config"]; ok {
+		return nil, fmt.Errorf("%s: -config can't be set from the config file", path)
+	}
+	return settings, nil
+}
+
+// validateLimits checks the settings a config reload may change.
+func validateLimits(cfg Config) error {
+	if cfg.MaxTTL < 0 {
+		return fmt.Errorf("invalid -max-ttl %v: must not be negative", cfg.MaxTTL)
+	}
+	switch cfg.MaxTTLMode {
+	case TTLCapClamp, TTLCapReject:
+	default:
+		return fmt.Errorf("invalid -max-ttl-mode %q", cfg.MaxTTLMode)
+	}
+	if cfg.MaxKeyBytes < 0 || cfg.MaxValueBytes < 0 {
+		return fmt.Errorf("invalid size limit: -max-key-bytes and -max-value-bytes must not be negative")
+	}
+	return nil
+}
+
+func parseConfig() (Config, error) {
+	var cfg Config
+	flag.BoolVar(&cfg.NormalizeKeys, "normalize-keys", false, "trim surrounding whitespace from keys on every access")
+	flag.BoolVar(&cfg.LowercaseKeys, "lowercase-keys", false, "fold keys to lower case on every access")
+	flag.DurationVar(&cfg.BackupInterval, "backup-interval", 0, "write a backup snapshot this often (0 disables)")
+	flag.StringVar(&cfg.BackupDir, "backup-dir", "backups", "directory for backup snapshots")
+	flag.IntVar(&cfg.BackupRetainCount, "backup-retain", 24, "number of backups to keep (0 keeps all)")
+	flag.DurationVar(&cfg.BackupRetainAge, "backup-max-age", 0, "delete backups older than this (0 disables)")
+	flag.BoolVar(&cfg.TrackAccess, "track-access", false, "count reads and writes per key for /hotkeys")
+	flag.IntVar(&cfg.AccessTrackerSize, "access-tracker-size", 10000, "maximum number of distinct keys tracked for /hotkeys")
+	flag.StringVar(&cfg.FsyncPolicy, "fsync-policy", FsyncInterval, "durability policy: always, interval or never")
+	flag.StringVar(&cfg.DataDir, "data-dir", ".", "directory for the data file, its metadata and its lock file")
+	flag.StringVar(&cfg.DataFile, "data-file", defaultDataFile, "file name of the snapshot in -data-dir")
+	flag.DurationVar(&cfg.SyncInterval, "sync-interval", defaultSyncInterval, "how often unsaved writes are snapshotted")
+	flag.StringVar(&cfg.WALDir, "wal-dir", "", "directory for "+walFile+" (defaults to -data-dir)")
+	flag.StringVar(&cfg.MirrorFile, "mirror-file", "", "also write each snapshot to this file, e.g. on a second disk, and load it if -data-file is unusable")
+	flag.BoolVar(&cfg.WAL, "wal", false, "log writes to "+walFile+" between snapshots and replay it on startup")
+	cfg.PrefixQuotas = make(prefixQuotaFlag)
+	flag.Var(prefixQuotaFlag(cfg.PrefixQuotas), "prefix-quota", "limit keys under a prefix, as prefix=max (repeatable)")
+	flag.Var(&cfg.FlushSchedules, "flush-schedule", "delete keys under a prefix on a cron schedule in local time, as \"0 0 * * *=daily:\" (repeatable)")
+	flag.BoolVar(&cfg.H2C, "h2c", false, "accept HTTP/2 over cleartext connections (h2c)")
+	flag.StringVar(&cfg.PprofAddr, "pprof-addr", "", "serve pprof handlers on this address, e.g. localhost:6060 (disabled if empty)")
+	flag.StringVar(&cfg.CredentialsFile, "credentials-file", "", "JSON file mapping API key IDs to bcrypt-hashed secrets; requires Basic auth on every request")
+	flag.BoolVar(&cfg.HashAPIKey, "hash-api-key", false, "read an API key secret from stdin, print its hash for -credentials-file and exit")
+	flag.StringVar(&cfg.ShardNodeID, "shard-node-id", "", "name of this node in a sharded cluster")
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", 120*time.Second, "close idle HTTP keep-alive connections after this long")
+	flag.BoolVar(&cfg.DisableKeepAlives, "disable-keepalives", false, "close HTTP connections after each request")
+	flag.BoolVar(&cfg.VerboseErrors, "verbose-errors", false, "include internal error details, such as file paths, in error responses")
+	flag.IntVar(&cfg.MaxConnsPerIP, "max-conns-per-ip", 0, "maximum concurrent HTTP connections from one client IP (0 disables)")
+	flag.DurationVar(&cfg.TCPKeepAlive, "tcp-keepalive", 15*time.Second, "TCP keep-alive probe period for HTTP connections (negative disables)")
+	flag.StringVar(&cfg.SeedFile, "seed-file", "", "JSON file of key/values to merge in at startup")
+	flag.BoolVar(&cfg.SeedOverwrite, "seed-overwrite", false, "let -seed-file overwrite keys loaded from disk")
+	flag.IntVar(&cfg.InitialCapacity, "initial-capacity", 0, "number of keys to pre-size the store for")
+	flag.IntVar(&cfg.MaxKeys, "max-keys", 0, "maximum number of keys (0 for no limit)")
+	flag.StringVar(&cfg.OverflowMode, "overflow-mode", OverflowReject, "what a new key does at -max-keys: reject or evict (least recently used)")
+	flag.DurationVar(&cfg.MaxTTL, "max-ttl", 0, "longest TTL a request may set (0 for no limit)")
+	flag.StringVar(&cfg.MaxTTLMode, "max-ttl-mode", TTLCapClamp, "what a TTL over -max-ttl does: clamp or reject")
+	flag.StringVar(&cfg.BatchDuplicates, "batch-duplicates", DuplicatesReject, "what a batch write that repeats a key does: reject or last-wins (/batch_set compares keys per 1000-entry chunk)")
+	flag.BoolVar(&cfg.IndexValues, "index-values", false, "maintain a reverse index from values to keys for /find_by_value")
+	flag.IntVar(&cfg.HistorySize, "history", 0, "keep this many recent values per key for /history (0 disables)")
+	flag.IntVar(&cfg.MaxKeyBytes, "max-key-bytes", 0, "reject keys longer than this many bytes (0 for no limit)")
+	flag.IntVar(&cfg.MaxValueBytes, "max-value-bytes", 0, "reject values longer than this many bytes (0 for no limit)")
+	flag.BoolVar(&cfg.RequireUTF8, "require-utf8", false, "reject values that aren't valid UTF-8")
+	flag.DurationVar(&cfg.MinSaveInterval, "min-save-interval", 0, "minimum time between disk saves; rapid save requests are coalesced (0 disables)")
+	flag.BoolVar(&cfg.ChangeLog, "change-log", false, "write a JSON change event to stdout for every set and delete")
+	flag.DurationVar(&cfg.SlowThreshold, "slow-threshold", 0, "log requests slower than this (0 disables)")
+	flag.StringVar(&cfg.CacheControl, "cache-control", "", "Cache-Control header for /get and /raw responses, e.g. \"public, max-age=60\"")
+	flag.BoolVar(&cfg.CacheControlTTL, "cache-control-ttl", false, "set Cache-Control max-age from the key's remaining TTL")
+	flag.StringVar(&cfg.HTTPAddr, "http-addr", httpPort, "HTTP listen address; an empty host listens on all IPv4 and IPv6 addresses")
+	flag.StringVar(&cfg.TCPAddr, "tcp-addr", tcpPort, "shutdown listener address")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 5*time.Second, "how long to wait for in-flight requests on shutdown")
+	flag.BoolVar(&cfg.Expvar, "expvar", false, "expose expvar metrics at /debug/vars")
+	flag.StringVar(&cfg.KeyPatternSource, "key-pattern", "", "regexp every key must match in full, e.g. [a-z0-9:_-]+ (empty accepts any key)")
+	flag.BoolVar(&cfg.KeyPatternReads, "key-pattern-reads", false, "also reject reads of keys that don't match -key-pattern")
+	flag.BoolVar(&cfg.InternValues, "intern-values", false, "share memory between identical values")
+	flag.StringVar(&cfg.ConfigFile, "config", "", "JSON file of flag settings, e.g. {\"max-value-bytes\": 1048576}; reloaded on SIGHUP")
+	shardSlots := flag.String("shard-slots", "0-16383", "hash slots owned by this node, e.g. 0-8191,9000")
+	flag.Parse()
+
+	cfg.explicitFlags = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { cfg.explicitFlags[f.Name] = true })
+	if err := applyEnv(cfg.explicitFlags); err != nil {
+		return cfg, err
+	}
+	if cfg.ConfigFile != "" {
+		settings, err := readConfigFile(cfg.ConfigFile)
+		if err != nil {
+			return cfg, err
+		}
+		for name, value := range settings {
+			if cfg.explicitFlags[name] {
+				continue
+			}
+			if err := flag.Set(name, value); err != nil {
+				return cfg, fmt.Errorf("%s: -%s: %w", cfg.ConfigFile, name, err)
+			}
+		}
+	}
+
+	switch cfg.FsyncPolicy {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return cfg, fmt.Errorf("invalid -fsync-policy %q", cfg.FsyncPolicy)
+	}
+
+	if cfg.DataFile == "" || cfg.DataFile != filepath.Base(cfg.DataFile) || cfg.DataFile == "." || cfg.DataFile == ".." {
+		return cfg, fmt.Errorf("invalid -data-file %q: must be a file name; use -data-dir for its directory", cfg.DataFile)
+	}
+	if cfg.SyncInterval <= 0 {
+		return cfg, fmt.Errorf("invalid -sync-interval %v: must be positive", cfg.SyncInterval)
+	}
+
+	if cfg.MirrorFile != "" {
+		mirror, err1 := filepath.Abs(cfg.MirrorFile)
+		primary, err2 := filepath.Abs(filepath.Join(cfg.DataDir, cfg.DataFile))
+		if err1 == nil && err2 == nil && mirror == primary {
+			return cfg, fmt.Errorf("invalid -mirror-file %q: it is the primary data file", cfg.MirrorFile)
+		}
+	}
+
+	if cfg.AccessTrackerSize <= 0 {
+		return cfg, fmt.Errorf("invalid -access-tracker-size %d: must be positive", cfg.AccessTrackerSize)
+	}
+
+	if cfg.InitialCapacity < 0 {
+		return cfg, fmt.Errorf("invalid -initial-capacity %d: must not be negative", cfg.InitialCapacity)
+	}
+
+	if cfg.MaxKeys < 0 {
+		return cfg, fmt.Errorf("invalid -max-keys %d: must not be negative", cfg.MaxKeys)
+	}
+	switch cfg.OverflowMode {
+	case OverflowReject, OverflowEvict:
+	default:
+		return cfg, fmt.Errorf("invalid -overflow-mode %q", cfg.OverflowMode)
+	}
+
+	if err := validateLimits(cfg); err != nil {
+		return cfg, err
+	}
+	switch cfg.BatchDuplicates {
+	case DuplicatesReject, DuplicatesLastWins:
+	default:
+		return cfg, fmt.Errorf("invalid -batch-duplicates %q", cfg.BatchDuplicates)
+	}
+
+	if cfg.HistorySize < 0 {
+		return cfg, fmt.Errorf("invalid -history %d: must not be negative", cfg.HistorySize)
+	}
+
+	if cfg.MinSaveInterval < 0 {
+		return cfg, fmt.Errorf("invalid -min-save-interval %v: must not be negative", cfg.MinSaveInterval)
+	}
+
+	for name, addr := range map[string]string{"-http-addr": cfg.HTTPAddr, "-tcp-addr": cfg.TCPAddr} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return cfg, fmt.Errorf("invalid %s %q: %w", name, addr, err)
+		}
+	}
+
+	if cfg.MaxConnsPerIP < 0 {
+		return cfg, fmt.Errorf("invalid -max-conns-per-ip %d: must not be negative", cfg.MaxConnsPerIP)
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		return cfg, fmt.Errorf("invalid -shutdown-timeout %v: must be positive", cfg.ShutdownTimeout)
+	}
+
+	slots, err := parseSlotRanges(*shardSlots)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid -shard-slots: %w", err)
+	}
+	cfg.ShardSlots = slots
+
+	if cfg.KeyPatternSource != "" {
+		re, err := regexp.Compile(`^(?:` + cfg.KeyPatternSource + `)$`)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid -key-pattern: %w", err)
+		}
+		cfg.KeyPattern = re
+	}
+
+	return cfg, nil
+}
+
+// normalizeKey applies the configured key normalization. Every method that
+// takes a key from a client must pass it through here so that a key written
+// in one form can be read back in any equivalent form.
+func (kvs *KeyValueStore) normalizeKey(key string) string {
+	if kvs.cfg.NormalizeKeys {
+		key = strings.TrimSpace(key)
+	}
+	if kvs.cfg.LowercaseKeys {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// normalizePrefix applies the configured key normalization to a key prefix,
+// so that a prefix matches the keys it would have matched before they were
+// normalized. Only leading whitespace is trimmed: a prefix can end where a
+// key has a space in the middle.
+func (kvs *KeyValueStore) normalizePrefix(prefix string) string {
+	if kvs.cfg.NormalizeKeys {
+		prefix = strings.TrimLeftFunc(prefix, unicode.IsSpace)
+	}
+	if kvs.cfg.LowercaseKeys {
+		prefix = strings.ToLower(prefix)
+	}
+	return prefix
+}
+
+// displayAddr turns a listen address into one a client can connect to for
+// log messages: an empty host becomes localhost and IPv6 hosts keep their
+// brackets.
+func displayAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// perIPListener caps how many connections each source IP may hold open at
+// once. Connections over the cap are closed as soon as they are accepted,
+// before any request is read, so a single client can't tie up the server's
+// connections however it paces its requests.
+type perIPListener struct {
+	net.Listener
+	max int
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newPerIPListener(l net.Listener, max int) *perIPListener {
+	return &perIPListener{Listener: l, max: max, counts: make(map[string]int)}
+}
+
+func (l *perIPListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := connIP(conn)
+
+		l.mu.Lock()
+		ok := l.counts[ip] < l.max
+		if ok {
+			l.counts[ip]++
+		}
+		l.mu.Unlock()
+
+		if ok {
+			return &perIPConn{Conn: conn, l: l, ip: ip}, nil
+		}
+		log.Printf("Refusing connection from %s: already has %d open", ip, l.max)
+		conn.Close()
+	}
+}
+
+func (l *perIPListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[ip]--; l.counts[ip] <= 0 {
+		delete(l.counts, ip)
+	}
+}
+
+// connIP returns the host part of conn's remote address.
+func connIP(conn net.Conn) string {
+	return hostOf(conn.RemoteAddr().String())
+}
+
+// requestIP returns the host part of r's remote address.
+func requestIP(r *http.Request) string {
+	return hostOf(r.RemoteAddr)
+}
+
+// hostOf returns the host part of a host:port address, or addr itself if
+// it has no port.
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// perIPConn gives its slot back to the listener the first time it is
+// closed. The server may close a connection more than once.
+type perIPConn struct {
+	net.Conn
+	l    *perIPListener
+	ip   string
+	once sync.Once
+}
+
+func (c *perIPConn) Close() error {
+	c.once.Do(func() { c.l.release(c.ip) })
+	return c.Conn.Close()
+}
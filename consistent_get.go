@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// ConsistentGetRequest lists the keys to read. MaxAge, in seconds, treats
+// keys last written longer ago than that as missing; zero disables it.
+type ConsistentGetRequest struct {
+	Keys   []string `json:"keys"`
+	MaxAge float64  `json:"max_age,omitempty"`
+}
+
+// ConsistentGetResponse maps each found key to its value. Missing lists the
+// requested keys that did not exist at the snapshot. Encodings names the
+// encoding of each value sent base64-encoded because it isn't valid UTF-8.
+type ConsistentGetResponse struct {
+	Values    map[string]string `json:"values"`
+	Encodings map[string]string `json:"encodings,omitempty"`
+	Missing   []string          `json:"missing"`
+}
+
+// GetMany reads all keys under a single acquisition of the read lock. No
+// write can run while the lock is held, so the result is a consistent
+// snapshot: every value comes from the same moment in the store's history.
+func (kvs *KeyValueStore) GetMany(keys []string) (map[string]string, []string) {
+	return kvs.GetManyFresh(keys, 0)
+}
+
+// GetManyFresh is GetMany that also treats keys last modified more than
+// maxAge ago as missing, for staleness-aware caching. Rewriting a key with
+// the value it already has doesn't count as modifying it. Keys with no
+// recorded modification time, such as those loaded from a snapshot written
+// before times were tracked, count as stale. A maxAge of zero accepts any
+// age.
+func (kvs *KeyValueStore) GetManyFresh(keys []string, maxAge time.Duration) (map[string]string, []string) {
+	normalized := make([]string, len(keys))
+	for i, key := range keys {
+		normalized[i] = kvs.normalizeKey(key)
+	}
+
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	now := time.Now()
+	values := make(map[string]string, len(keys))
+	missing := []string{}
+	for _, key := range normalized {
+		kvs.ops.gets.Add(1)
+		kvs.recordAccess(key, false)
+		value, ok := kvs.lookupLocked(key, now)
+		if ok && maxAge > 0 {
+			modified, known := kvs.modified[key]
+			ok = known && now.Sub(modified) <= maxAge
+		}
+		if ok {
+			values[key] = value
+			kvs.touchKey(key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return values, missing
+}
+
+func (kvs *KeyValueStore) handleConsistentGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req ConsistentGetRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxAge < 0 {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "max_age must not be negative"}, http.StatusBadRequest)
+		return
+	}
+
+	for _, key := range req.Keys {
+		if kvs.normalizeKey(key) == "" {
+			sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+			return
+		}
+		if err := kvs.validateReadKey(kvs.normalizeKey(key)); err != nil {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidKey, Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	maxAge := time.Duration(req.MaxAge * float64(time.Second))
+	values, missing := kvs.GetManyFresh(req.Keys, maxAge)
+	resp := ConsistentGetResponse{Values: values, Missing: missing}
+	for key, value := range values {
+		if encoded, encoding := encodeValue(value); encoding != "" {
+			if resp.Encodings == nil {
+				resp.Encodings = make(map[string]string)
+			}
+			values[key], resp.Encodings[key] = encoded, encoding
+		}
+	}
+	sendJSONResponse(w, resp, http.StatusOK)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestGetManyIsAtomic writes a and b together, always with the same value,
+// while reading them concurrently: a read that interleaved with a write
+// would see the pair disagree.
+func TestGetManyIsAtomic(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.SetManyTTL([]SetTTLEntry{{Key: "a", Value: "0"}, {Key: "b", Value: "0"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			v := strconv.Itoa(i)
+			if err := kvs.SetManyTTL([]SetTTLEntry{{Key: "a", Value: v}, {Key: "b", Value: v}}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 2000; i++ {
+		values, missing := kvs.GetMany([]string{"a", "b"})
+		if len(missing) != 0 || values["a"] != values["b"] {
+			t.Errorf("read %v (missing %v), want a and b equal", values, missing)
+			break
+		}
+	}
+
+	rec := serve(kvs.handleConsistentGet, http.MethodPost, "/consistent_get", `{"keys":["a","b","c"]}`)
+	close(done)
+	wg.Wait()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp ConsistentGetResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Values["a"] != resp.Values["b"] || len(resp.Missing) != 1 || resp.Missing[0] != "c" {
+		t.Errorf("/consistent_get = %+v, want a and b equal and c missing", resp)
+	}
+}
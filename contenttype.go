@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const defaultRawContentType = "application/octet-stream"
+
+// ErrInvalidContentType is returned for a content type that isn't a valid
+// media type.
+var ErrInvalidContentType = errors.New("invalid content type")
+
+// setContentTypeLocked records contentType for key, or clears it when
+// contentType is empty. Callers must hold kvs.mu for writing.
+func (kvs *KeyValueStore) setContentTypeLocked(key, contentType string) {
+	current, ok := kvs.contentTypes[key]
+	switch {
+	case contentType == "" && ok:
+		delete(kvs.contentTypes, key)
+		kvs.logContentTypeLocked(key, "")
+		kvs.dirty = true
+	case contentType != "" && current != contentType:
+		kvs.contentTypes[key] = contentType
+		kvs.logContentTypeLocked(key, contentType)
+		kvs.dirty = true
+	}
+}
+
+// GetRaw returns key's value together with its recorded content type.
+func (kvs *KeyValueStore) GetRaw(key string) (value, contentType string, ok bool) {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	value, ok = kvs.lookupLocked(key, time.Now())
+	kvs.ops.gets.Add(1)
+	kvs.recordAccess(key, false)
+	if ok {
+		kvs.touchKey(key)
+	}
+	return value, kvs.contentTypes[key], ok
+}
+
+// validateContentType checks that contentType, if set, parses as a media
+// type.
+func validateContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return ErrInvalidContentType
+	}
+	return nil
+}
+
+// handleRaw serves a value unwrapped, with the content type recorded when it
+// was set, so the store can act as a simple origin for small objects.
+func (kvs *KeyValueStore) handleRaw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendMethodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	key := r.PathValue("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+	if err := kvs.validateReadKey(kvs.normalizeKey(key)); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidKey, Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	value, contentType, ok := kvs.GetRaw(key)
+	if !ok {
+		sendJSONResponse(w, ErrorResponse{Code: CodeKeyNotFound, Error: "Key not found"}, http.StatusNotFound)
+		return
+	}
+	if contentType == "" {
+		contentType = defaultRawContentType
+	}
+
+	kvs.setCacheHeaders(w, key)
+	etag := valueETag(value)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write([]byte(value))
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week. Each field is a set of allowed values.
+type cronSchedule struct {
+	expr                          string
+	minute, hour, dom, month, dow map[int]bool
+	// Following cron, when both day fields are restricted a time matches
+	// if either one does.
+	domAny, dowAny bool
+}
+
+// parseCron parses a standard five-field cron expression. Fields accept
+// "*", single values, ranges (1-5), lists (1,15) and steps (*/15, 0-30/10).
+// Day of week runs from 0 (Sunday) to 6, and 7 is accepted as Sunday.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	s := &cronSchedule{expr: expr}
+	bounds := []struct {
+		set      *map[int]bool
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		set, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		*b.set = set
+	}
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			var err error
+			if i := strings.Index(rng, "-"); i >= 0 {
+				lo, err = strconv.Atoi(rng[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(rng[i+1:])
+				}
+			} else {
+				lo, err = strconv.Atoi(rng)
+				hi = lo
+			}
+			if err != nil || lo < min || hi > max || lo > hi {
+				return nil, fmt.Errorf("invalid value %q (allowed %d-%d)", part, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// matches reports whether t falls in a minute the schedule fires on.
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+	domOK, dowOK := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domAny || s.dowAny {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// flushSchedule deletes every key under prefix whenever schedule fires.
+type flushSchedule struct {
+	schedule *cronSchedule
+	prefix   string
+}
+
+// flushScheduleFlag collects repeated -flush-schedule "cron=prefix" flags.
+type flushScheduleFlag []flushSchedule
+
+func (f *flushScheduleFlag) String() string {
+	parts := make([]string, 0, len(*f))
+	for _, fs := range *f {
+		parts = append(parts, fs.schedule.expr+"="+fs.prefix)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *flushScheduleFlag) Set(s string) error {
+	// Cron expressions never contain "=", so the first one separates the
+	// schedule from a prefix that might.
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("expected \"cron expression=prefix\", got %q", s)
+	}
+	schedule, err := parseCron(s[:i])
+	if err != nil {
+		return err
+	}
+	*f = append(*f, flushSchedule{schedule: schedule, prefix: s[i+1:]})
+	return nil
+}
+
+// DeletePrefix removes every key that starts with prefix and returns how
+// many live keys were deleted.
+func (kvs *KeyValueStore) DeletePrefix(prefix string) int {
+	prefix = kvs.normalizePrefix(prefix)
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for key := range kvs.store {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		expired := kvs.expiries.expired(key, now)
+		if kvs.deleteLocked(key) && !expired {
+			count++
+		}
+	}
+	return count
+}
+
+// startFlushScheduler runs the -flush-schedule entries, waking at the start
+// of every minute in local time. A minute missed while the process was down
+// is not caught up.
+func (kvs *KeyValueStore) startFlushScheduler(ctx context.Context) {
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case tick := <-timer.C:
+			for _, fs := range kvs.cfg.FlushSchedules {
+				if fs.schedule.matches(tick) {
+					n := kvs.DeletePrefix(fs.prefix)
+					log.Printf("Scheduled flush %q deleted %d keys under %q", fs.schedule.expr, n, fs.prefix)
+				}
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// saveDebouncer limits saves to one start per minInterval. Callers that
+// arrive while a save is waiting for its slot join that save instead of
+// queueing another, so a burst of writes costs one disk write. A caller is
+// only released once a save that started after it arrived has finished,
+// which keeps per-write durability intact.
+type saveDebouncer struct {
+	minInterval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	pending *pendingSave
+}
+
+// pendingSave is a save that has been scheduled but not started yet.
+type pendingSave struct {
+	done chan struct{}
+	err  error
+}
+
+func newSaveDebouncer(minInterval time.Duration) *saveDebouncer {
+	return &saveDebouncer{minInterval: minInterval}
+}
+
+// save runs fn, or waits for an already scheduled run of it, and returns
+// that run's error.
+func (d *saveDebouncer) save(fn func() error) error {
+	d.mu.Lock()
+	if p := d.pending; p != nil {
+		d.mu.Unlock()
+		<-p.done
+		return p.err
+	}
+	p := &pendingSave{done: make(chan struct{})}
+	d.pending = p
+	wait := time.Until(d.last.Add(d.minInterval))
+	d.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	// Anyone arriving from here on may have written after fn takes its
+	// snapshot, so they must schedule the next save rather than join this
+	// one.
+	d.mu.Lock()
+	d.pending = nil
+	d.last = time.Now()
+	d.mu.Unlock()
+
+	p.err = fn()
+	close(p.done)
+	return p.err
+}
+
+// requestSave saves the store, going through the debouncer when
+// -min-save-interval is set. Shutdown saves call saveToDisk directly so
+// they never wait for a slot.
+func (kvs *KeyValueStore) requestSave() error {
+	if kvs.saves == nil {
+		return kvs.saveToDisk()
+	}
+	return kvs.saves.save(kvs.saveToDisk)
+}
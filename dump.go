@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Dump returns a copy of every key/value pair whose key starts with prefix.
+// An empty prefix exports the whole store.
+func (kvs *KeyValueStore) Dump(prefix string) map[string]string {
+	prefix = kvs.normalizePrefix(prefix)
+	return kvs.snapshotEntries(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}, 0)
+}
+
+func (kvs *KeyValueStore) handleDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	// Values that aren't valid UTF-8 are sent as in the data file, as
+	// {"encoding": "base64", "value": ...} objects.
+	prefix := r.URL.Query().Get("prefix")
+	sendJSONResponse(w, snapshotData(kvs.Dump(prefix)), http.StatusOK)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixesAreNormalized(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.NormalizeKeys, cfg.LowercaseKeys = true, true
+	kvs := newTestStore(t, cfg)
+	for _, key := range []string{"User:1", "user:2 b", "other"} {
+		if err := kvs.Set(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := kvs.Dump("  USER:"); len(got) != 2 {
+		t.Errorf("Dump(%q) = %v, want the two user: keys", "  USER:", got)
+	}
+	if got := kvs.Dump("User:2 "); len(got) != 1 {
+		t.Errorf("Dump(%q) = %v, want just user:2 b, as a trailing space can be part of a key", "User:2 ", got)
+	}
+	if rec := serve(kvs.handleDump, http.MethodGet, "/dump?prefix=USER%3A", ""); !strings.Contains(rec.Body.String(), "user:1") {
+		t.Errorf("GET /dump?prefix=USER: = %s, want user:1", rec.Body)
+	}
+	if keys, _ := kvs.Scan(" User:", "", 10); len(keys) != 2 {
+		t.Errorf("Scan = %v, want the two user: keys", keys)
+	}
+	if n, err := kvs.ExpirePrefix(" USER:", time.Hour); err != nil || n != 2 {
+		t.Errorf("ExpirePrefix = %d, %v; want 2", n, err)
+	}
+	if n := kvs.DeletePrefix("USER:"); n != 2 {
+		t.Errorf("DeletePrefix = %d, want 2", n)
+	}
+}
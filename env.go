@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// envPrefix starts the environment variables that set flags. The rest of
+// the name is the flag name upper-cased with dashes as underscores, so
+// KVSTORE_MAX_VALUE_BYTES sets -max-value-bytes. A repeatable flag such as
+// -prefix-quota takes a single value from the environment.
+const envPrefix = "KVSTORE_"
+
+// envFlagName maps an environment variable name to the flag it sets.
+func envFlagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(env, envPrefix)), "_", "-")
+}
+
+// applyEnv sets every flag named by a KVSTORE_ variable that wasn't given on
+// the command line, and records it in explicit so that it outranks the
+// -config file, both at startup and on reload. Variables that match no
+// flag are logged and ignored.
+func applyEnv(explicit map[string]bool) error {
+	for _, kv := range os.Environ() {
+		env, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(env, envPrefix) {
+			continue
+		}
+		name := envFlagName(env)
+		if flag.Lookup(name) == nil {
+			log.Printf("Ignoring %s: there is no -%s flag", env, name)
+			continue
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s %q for -%s: %w", env, value, name, err)
+		}
+		explicit[name] = true
+	}
+	return nil
+}
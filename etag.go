@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrPreconditionFailed is returned by conditional writes whose If-Match
+// doesn't match the current value.
+var ErrPreconditionFailed = errors.New("current value does not match If-Match")
+
+// valueChecksum returns the hex-encoded SHA-256 of value. Clients can
+// compute the same digest to verify a value survived the round trip.
+func valueChecksum(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// valueETag returns a strong entity tag for value. It is derived from the
+// content alone, so identical values always produce the same tag.
+func valueETag(value string) string {
+	return `"` + valueChecksum(value) + `"`
+}
+
+// etagMatches reports whether etag satisfies an If-None-Match or If-Match
+// header value, which may be "*" or a comma-separated list of tags.
+// Weak tags are compared by their opaque value.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
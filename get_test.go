@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHandleGetEmptyValue(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("empty", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(kvs.handleGet, http.MethodGet, "/get?key=empty", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("empty value: status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp GetResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Found || resp.Value != "" {
+		t.Errorf("empty value: got %+v, want found with an empty value", resp)
+	}
+
+	rec = serve(kvs.handleGet, http.MethodGet, "/get?key=missing", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing key: status %d, want 404: %s", rec.Code, rec.Body)
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+		t.Fatal(err)
+	}
+	if errResp.Code != CodeKeyNotFound {
+		t.Errorf("missing key: code %q, want %q", errResp.Code, CodeKeyNotFound)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// saveHealth tracks the outcome of recent saves so a failing disk shows up
+// in /health and the metrics instead of only in the log.
+type saveHealth struct {
+	failures atomic.Uint64
+
+	mu        sync.Mutex
+	lastErr   error
+	lastErrAt time.Time
+	diskFull  bool
+}
+
+// record notes the result of a save. Running out of space is logged once
+// when it starts and once when it clears rather than on every retry; the
+// data stays dirty, so the next sync tick retries on its own.
+func (h *saveHealth) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		if h.diskFull {
+			log.Printf("Disk space available again, saves are succeeding")
+		}
+		h.lastErr = nil
+		h.diskFull = false
+		return
+	}
+
+	h.failures.Add(1)
+	h.lastErr = err
+	h.lastErrAt = time.Now()
+	full := errors.Is(err, syscall.ENOSPC)
+	if full && !h.diskFull {
+		log.Printf("Disk full, saves will be retried until space is freed: %v", err)
+	}
+	h.diskFull = full
+}
+
+type HealthResponse struct {
+	Status        string     `json:"status"`
+	DiskFull      bool       `json:"disk_full"`
+	FailedSaves   uint64     `json:"failed_saves"`
+	LastSaveError string     `json:"last_save_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Health reports whether the most recent save succeeded.
+func (kvs *KeyValueStore) Health() HealthResponse {
+	h := &kvs.saveHealth
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	resp := HealthResponse{Status: "ok", DiskFull: h.diskFull, FailedSaves: h.failures.Load()}
+	if h.lastErr != nil {
+		at := h.lastErrAt
+		resp.Status = "degraded"
+		// /health is open without credentials, so the error itself, which
+		// usually names a file, is only shown with -verbose-errors.
+		resp.LastSaveError = "save failed; see the server log"
+		if kvs.cfg.VerboseErrors {
+			resp.LastSaveError = h.lastErr.Error()
+		}
+		resp.LastErrorAt = &at
+	}
+	return resp
+}
+
+func (kvs *KeyValueStore) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	health := kvs.Health()
+	status := http.StatusOK
+	if health.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	sendJSONResponse(w, health, status)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxDeletedHistories bounds how many deleted keys keep their history. Each
+// is still capped at -history entries, but deleted keys no longer count
+// toward -max-keys, so without a bound a workload that churns through keys
+// would grow history forever. The longest deleted are dropped first.
+const maxDeletedHistories = 10000
+
+// HistoryEntry is one past value of a key and when it was written. Deleted
+// marks the entry recording the key's deletion, whose Value is empty.
+// Encoding is set in /history responses as in GetResponse.
+type HistoryEntry struct {
+	Value    string    `json:"value"`
+	Encoding string    `json:"encoding,omitempty"`
+	SetAt    time.Time `json:"set_at"`
+	Deleted  bool      `json:"deleted,omitempty"`
+}
+
+// HistoryResponse lists a key's recorded values, newest first.
+type HistoryResponse struct {
+	Key     string         `json:"key"`
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// keyHistory is a fixed-size ring of a key's most recent values.
+type keyHistory struct {
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+func (h *keyHistory) add(e HistoryEntry) {
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// recent returns up to limit entries, newest first.
+func (h *keyHistory) recent(limit int) []HistoryEntry {
+	n := h.next
+	if h.full {
+		n = len(h.entries)
+	}
+	if limit > n {
+		limit = n
+	}
+	out := make([]HistoryEntry, 0, limit)
+	for i := 0; i < limit; i++ {
+		idx := (h.next - 1 - i + len(h.entries)) % len(h.entries)
+		out = append(out, h.entries[idx])
+	}
+	return out
+}
+
+// deletedHistories orders deleted keys that still have a history, oldest
+// deletion at the back. It is guarded by kvs.mu.
+type deletedHistories struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newDeletedHistories() *deletedHistories {
+	return &deletedHistories{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+// add records key as deleted just now and returns the keys that fell off
+// the end of maxDeletedHistories.
+func (d *deletedHistories) add(key string) []string {
+	d.remove(key)
+	d.elems[key] = d.order.PushFront(key)
+	var dropped []string
+	for d.order.Len() > maxDeletedHistories {
+		oldest := d.order.Remove(d.order.Back()).(string)
+		delete(d.elems, oldest)
+		dropped = append(dropped, oldest)
+	}
+	return dropped
+}
+
+// remove forgets key and reports whether it was tracked.
+func (d *deletedHistories) remove(key string) bool {
+	elem, ok := d.elems[key]
+	if ok {
+		d.order.Remove(elem)
+		delete(d.elems, key)
+	}
+	return ok
+}
+
+// recordHistoryLocked appends value to key's history when -history is set.
+// History lives only in memory. Callers must hold kvs.mu for writing.
+func (kvs *KeyValueStore) recordHistoryLocked(key, value string, now time.Time) {
+	if kvs.history == nil {
+		return
+	}
+	kvs.deletedHistory.remove(key)
+	kvs.addHistoryLocked(key, HistoryEntry{Value: value, SetAt: now})
+}
+
+// recordDeleteHistoryLocked ends key's history with a deletion entry. The
+// history is kept, so /history can still show what an unexpectedly deleted
+// key held, until maxDeletedHistories newer deletions push it out or the key
+// is written again. Callers must hold kvs.mu for writing.
+func (kvs *KeyValueStore) recordDeleteHistoryLocked(key string, now time.Time) {
+	if kvs.history == nil {
+		return
+	}
+	kvs.addHistoryLocked(key, HistoryEntry{SetAt: now, Deleted: true})
+	for _, dropped := range kvs.deletedHistory.add(key) {
+		delete(kvs.history, dropped)
+	}
+}
+
+func (kvs *KeyValueStore) addHistoryLocked(key string, e HistoryEntry) {
+	h, ok := kvs.history[key]
+	if !ok {
+		h = &keyHistory{entries: make([]HistoryEntry, kvs.cfg.HistorySize)}
+		kvs.history[key] = h
+	}
+	h.add(e)
+}
+
+// History returns up to limit of key's recorded values, newest first. A
+// deleted key's history starts with the entry recording the deletion.
+func (kvs *KeyValueStore) History(key string, limit int) []HistoryEntry {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	h, ok := kvs.history[key]
+	if !ok {
+		return []HistoryEntry{}
+	}
+	return h.recent(limit)
+}
+
+func (kvs *KeyValueStore) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	if kvs.history == nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeFeatureDisabled, Error: "Key history is not enabled"}, http.StatusNotFound)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	limit := kvs.cfg.HistorySize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid limit"}, http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	entries := kvs.History(key, limit)
+	for i := range entries {
+		entries[i].Value, entries[i].Encoding = encodeValue(entries[i].Value)
+	}
+	sendJSONResponse(w, HistoryResponse{Key: kvs.normalizeKey(key), Entries: entries}, http.StatusOK)
+}
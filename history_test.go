@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHistoryKeptAfterDelete(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HistorySize = 3
+	kvs := newTestStore(t, cfg)
+	for _, v := range []string{"1", "2"} {
+		if err := kvs.Set("k", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !kvs.Delete("k") {
+		t.Fatal("Delete found no key")
+	}
+
+	got := kvs.History("k", 10)
+	if len(got) != 3 || !got[0].Deleted || got[1].Value != "2" || got[2].Value != "1" {
+		t.Fatalf("history after delete = %+v, want the deletion, then 2 and 1", got)
+	}
+
+	// Writing the key again continues the same bounded history.
+	if err := kvs.Set("k", "3"); err != nil {
+		t.Fatal(err)
+	}
+	got = kvs.History("k", 10)
+	if len(got) != 3 || got[0].Value != "3" || !got[1].Deleted || got[2].Value != "2" {
+		t.Errorf("history after recreating = %+v, want 3, the deletion, then 2", got)
+	}
+}
+
+func TestDeletedHistoriesBounded(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HistorySize = 1
+	kvs := newTestStore(t, cfg)
+
+	// Keep one live key across all the churn below; its history must
+	// survive however many other keys are deleted.
+	if err := kvs.Set("live", "v"); err != nil {
+		t.Fatal(err)
+	}
+	n := maxDeletedHistories + 100
+	for i := 0; i < n; i++ {
+		key := "k" + strconv.Itoa(i)
+		if err := kvs.Set(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+		kvs.Delete(key)
+	}
+
+	kvs.mu.RLock()
+	histories := len(kvs.history)
+	kvs.mu.RUnlock()
+	if histories != maxDeletedHistories+1 {
+		t.Errorf("%d histories kept, want %d deleted keys plus the live one", histories, maxDeletedHistories)
+	}
+	if got := kvs.History("k0", 1); len(got) != 0 {
+		t.Errorf("the oldest deleted key still has history %+v", got)
+	}
+	if got := kvs.History("k"+strconv.Itoa(n-1), 1); len(got) != 1 || !got[0].Deleted {
+		t.Errorf("the newest deleted key has history %+v, want its deletion", got)
+	}
+	if got := kvs.History("live", 1); len(got) != 1 || got[0].Value != "v" {
+		t.Errorf("live key has history %+v, want v", got)
+	}
+}
+
+func TestHistoryKeptAcrossReplaceAll(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HistorySize = 3
+	kvs := newTestStore(t, cfg)
+	for key, value := range map[string]string{"removed": "1", "changed": "1", "same": "1"} {
+		if err := kvs.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kvs.ReplaceAll(map[string]string{"changed": "2", "same": "1", "added": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := kvs.History("removed", 10); len(got) != 2 || !got[0].Deleted || got[1].Value != "1" {
+		t.Errorf("removed history = %+v, want the deletion, then 1", got)
+	}
+	if got := kvs.History("changed", 10); len(got) != 2 || got[0].Value != "2" || got[1].Value != "1" {
+		t.Errorf("changed history = %+v, want 2, then 1", got)
+	}
+	if got := kvs.History("same", 10); len(got) != 1 || got[0].Value != "1" {
+		t.Errorf("same history = %+v, want just 1", got)
+	}
+	if got := kvs.History("added", 10); len(got) != 1 || got[0].Value != "1" {
+		t.Errorf("added history = %+v, want 1", got)
+	}
+}
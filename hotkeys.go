@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// accessTracker keeps approximate per-key read and write counts. It never
+// holds more than max keys: when a new key arrives at the limit, every count
+// is halved, so recent traffic dominates, and the least accessed keys are
+// forgotten until a quarter of the tracker is free.
+type accessTracker struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*accessCount
+}
+
+type accessCount struct {
+	reads  uint64
+	writes uint64
+}
+
+type HotKey struct {
+	Key    string `json:"key"`
+	Reads  uint64 `json:"reads"`
+	Writes uint64 `json:"writes"`
+}
+
+type HotKeysResponse struct {
+	Keys []HotKey `json:"keys"`
+}
+
+func newAccessTracker(max int) *accessTracker {
+	return &accessTracker{
+		max:     max,
+		entries: make(map[string]*accessCount),
+	}
+}
+
+func (t *accessTracker) record(key string, write bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok {
+		if len(t.entries) >= t.max {
+			t.makeRoom()
+		}
+		entry = &accessCount{}
+		t.entries[key] = entry
+	}
+	if write {
+		entry.writes++
+	} else {
+		entry.reads++
+	}
+}
+
+// makeRoom halves every count and then drops the least accessed keys until
+// at most three quarters of max remain. Each pass costs O(n log n) but frees
+// max/4 slots, so it runs once per max/4 new keys and recording stays cheap
+// on average however skewed the counts are. Callers must hold t.mu.
+func (t *accessTracker) makeRoom() {
+	keep := t.max - max(t.max/4, 1)
+	totals := make([]uint64, 0, len(t.entries))
+	for _, entry := range t.entries {
+		entry.reads /= 2
+		entry.writes /= 2
+		totals = append(totals, entry.reads+entry.writes)
+	}
+	if keep <= 0 {
+		clear(t.entries)
+		return
+	}
+
+	// Keep the keep highest totals; ties at the cutoff are broken by map
+	// order, which is fine for approximate counts.
+	slices.Sort(totals)
+	cutoff := totals[len(totals)-keep]
+	for key, entry := range t.entries {
+		if entry.reads+entry.writes < cutoff {
+			delete(t.entries, key)
+		}
+	}
+	for key, entry := range t.entries {
+		if len(t.entries) <= keep {
+			break
+		}
+		if entry.reads+entry.writes == cutoff {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// top returns up to n keys ordered by total accesses, most accessed first.
+func (t *accessTracker) top(n int) []HotKey {
+	t.mu.Lock()
+	keys := make([]HotKey, 0, len(t.entries))
+	for key, entry := range t.entries {
+		keys = append(keys, HotKey{Key: key, Reads: entry.reads, Writes: entry.writes})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		ti, tj := keys[i].Reads+keys[i].Writes, keys[j].Reads+keys[j].Writes
+		if ti != tj {
+			return ti > tj
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// recordAccess counts an access to key when access tracking is enabled.
+func (kvs *KeyValueStore) recordAccess(key string, write bool) {
+	if kvs.access != nil {
+		kvs.access.record(key, write)
+	}
+}
+
+func (kvs *KeyValueStore) handleHotKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	if kvs.access == nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeFeatureDisabled, Error: "Access tracking is not enabled"}, http.StatusNotFound)
+		return
+	}
+
+	top := 10
+	if s := r.URL.Query().Get("top"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid top"}, http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	sendJSONResponse(w, HotKeysResponse{Keys: kvs.access.top(top)}, http.StatusOK)
+}
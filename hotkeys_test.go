@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestAccessTrackerEnforcesCap(t *testing.T) {
+	const size = 100
+	tracker := newAccessTracker(size)
+
+	// Every key is accessed several times, so halving alone would drop
+	// none of them.
+	for i := 0; i < 10*size; i++ {
+		key := "k" + strconv.Itoa(i)
+		for j := 0; j < 8; j++ {
+			tracker.record(key, j%2 == 0)
+		}
+		if n := len(tracker.entries); n > size {
+			t.Fatalf("tracking %d keys after %d distinct keys, cap is %d", n, i+1, size)
+		}
+	}
+}
+
+func TestAccessTrackerKeepsHotKeys(t *testing.T) {
+	const size = 100
+	tracker := newAccessTracker(size)
+	for i := 0; i < 20*size; i++ {
+		tracker.record("hot", false)
+		tracker.record("warm", true)
+		if i%2 == 0 {
+			tracker.record("warm", true)
+		}
+		tracker.record("cold"+strconv.Itoa(i), false)
+	}
+
+	top := tracker.top(2)
+	if len(top) != 2 || top[0].Key != "warm" || top[1].Key != "hot" {
+		t.Fatalf("top(2) = %+v, want warm then hot", top)
+	}
+	if top[0].Writes == 0 || top[1].Reads == 0 {
+		t.Errorf("top(2) = %+v, want writes for warm and reads for hot", top)
+	}
+}
+
+func TestAccessTrackerSizeOne(t *testing.T) {
+	tracker := newAccessTracker(1)
+	for _, key := range []string{"a", "b", "c"} {
+		tracker.record(key, false)
+	}
+	if top := tracker.top(10); len(top) != 1 || top[0].Key != "c" {
+		t.Errorf("top = %+v, want only the newest key", top)
+	}
+}
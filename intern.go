@@ -0,0 +1,60 @@
+package main
+
+import "strings"
+
+// internTable deduplicates values so keys holding identical values share one
+// string allocation. Each distinct value is reference counted by the number
+// of keys holding it and dropped when the last one goes away. It is guarded
+// by kvs.mu.
+type internTable struct {
+	values map[string]*internEntry
+	// saved is the number of value bytes not allocated thanks to sharing.
+	saved int64
+}
+
+type internEntry struct {
+	value string
+	refs  int
+}
+
+func newInternTable() *internTable {
+	return &internTable{values: make(map[string]*internEntry)}
+}
+
+// acquire returns the canonical copy of value and takes a reference to it.
+func (t *internTable) acquire(value string) string {
+	if entry, ok := t.values[value]; ok {
+		entry.refs++
+		t.saved += int64(len(value))
+		return entry.value
+	}
+	// Clone so the table never pins a larger buffer (such as a request
+	// body) that value happens to point into.
+	canonical := strings.Clone(value)
+	t.values[canonical] = &internEntry{value: canonical, refs: 1}
+	return canonical
+}
+
+// release drops a reference taken by acquire.
+func (t *internTable) release(value string) {
+	entry, ok := t.values[value]
+	if !ok {
+		return
+	}
+	entry.refs--
+	if entry.refs == 0 {
+		delete(t.values, value)
+	} else {
+		t.saved -= int64(len(value))
+	}
+}
+
+// rebuild resets the table from store, replacing each value in store with
+// its canonical copy.
+func (t *internTable) rebuild(store map[string]string) {
+	t.values = make(map[string]*internEntry)
+	t.saved = 0
+	for key, value := range store {
+		store[key] = t.acquire(value)
+	}
+}
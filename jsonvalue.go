@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// decodeJSONValue parses a stored value as a single JSON document. Numbers
+// decode as json.Number rather than float64, so an integer beyond 2^53
+// (a 19-digit ID, say) survives being decoded and re-encoded digit for
+// digit. Every handler that looks inside a JSON value should decode it
+// here rather than with json.Unmarshal.
+func decodeJSONValue(value string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errTrailingJSON
+	}
+	return doc, nil
+}
+
+// encodeJSONValue is the inverse of decodeJSONValue. It leaves <, > and &
+// alone, since the result is stored or returned as data rather than
+// embedded in HTML.
+func encodeJSONValue(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
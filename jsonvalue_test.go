@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// bigID needs 63 bits, well past the 2^53 a float64 holds exactly.
+const bigID = "9007199254740993123"
+
+func TestJSONValueKeepsLargeIntegers(t *testing.T) {
+	value := `{"id":` + bigID + `,"ids":[` + bigID + `]}`
+	doc, err := decodeJSONValue(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := encodeJSONValue(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != value {
+		t.Errorf("round trip = %s, want %s", got, value)
+	}
+
+	if got, err := projectJSON(value, "id"); err != nil || got != bigID {
+		t.Errorf("projectJSON(id) = %s, %v, want %s", got, err, bigID)
+	}
+	if got, err := projectJSON(value, "ids.0"); err != nil || got != bigID {
+		t.Errorf("projectJSON(ids.0) = %s, %v, want %s", got, err, bigID)
+	}
+}
+
+func TestAppendJSONKeepsLargeIntegers(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("list", `[`+bigID+`]`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kvs.AppendJSON("list", json.RawMessage(bigID)); err != nil {
+		t.Fatal(err)
+	}
+	want := `[` + bigID + `,` + bigID + `]`
+	if got, _ := kvs.Get("list"); got != want {
+		t.Errorf("list = %s, want %s", got, want)
+	}
+}
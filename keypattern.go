@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidKey is returned when a key doesn't match the configured
+// -key-pattern.
+var ErrInvalidKey = errors.New("invalid key")
+
+// validateKey checks an already normalized key against the configured
+// length limit and key pattern. With neither set every key is accepted.
+func (kvs *KeyValueStore) validateKey(key string) error {
+	if limit := kvs.current().MaxKeyBytes; limit > 0 && len(key) > limit {
+		return fmt.Errorf("%w: key is %d bytes, limit is %d", ErrInvalidKey, len(key), limit)
+	}
+	if kvs.cfg.KeyPattern != nil && !kvs.cfg.KeyPattern.MatchString(key) {
+		return fmt.Errorf("%w: %q does not match pattern %s", ErrInvalidKey, key, kvs.cfg.KeyPatternSource)
+	}
+	return nil
+}
+
+// validateReadKey is validateKey for read paths, which are only checked
+// when -key-pattern-reads is set.
+func (kvs *KeyValueStore) validateReadKey(key string) error {
+	if !kvs.cfg.KeyPatternReads {
+		return nil
+	}
+	return kvs.validateKey(key)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// handleKV serves /kv/{key...}, a RESTful view of the store: GET reads,
+// PUT writes the request body as the value and DELETE removes the key.
+// The trailing wildcard takes the rest of the path, so hierarchical keys
+// such as a/b/c need no escaping; the mux percent-decodes the path, so
+// spaces, unicode and an escaped %2F all arrive as the literal characters.
+// The mux cleans paths before matching, though, so keys with empty or dot
+// segments (a//b, a/./b) redirect and have to go through /set and /get.
+func (kvs *KeyValueStore) handleKV(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	switch r.Method {
+	case http.MethodGet:
+		kvs.serveGet(w, r, key)
+	case http.MethodPut:
+		kvs.servePut(w, r, key)
+	case http.MethodDelete:
+		kvs.serveDelete(w, r, key)
+	default:
+		sendMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// servePut stores the raw request body under key. A Content-Type on the
+// request is recorded for /raw, and If-Match makes the write conditional
+// just as it does on /set.
+func (kvs *KeyValueStore) servePut(w http.ResponseWriter, r *http.Request, key string) {
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	if limit := kvs.current().MaxValueBytes; limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(limit)+1)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeValueTooLarge, Error: "Request body too large"}, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+	value := string(body)
+
+	end := startSpan(r.Context(), "store.Set", key)
+	_, existed, err := kvs.SwapIfMatch(key, value, r.Header.Get("Content-Type"), r.Header.Get("If-Match"))
+	end()
+	if errors.Is(err, ErrPreconditionFailed) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeVersionConflict, Error: err.Error()}, http.StatusConflict)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+
+	w.Header().Set("ETag", valueETag(value))
+	status := http.StatusOK
+	if !existed {
+		status = http.StatusCreated
+	}
+	sendJSONResponse(w, SetResponse{Status: "OK", Checksum: valueChecksum(value)}, status)
+}
+
+func (kvs *KeyValueStore) serveDelete(w http.ResponseWriter, r *http.Request, key string) {
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+	end := startSpan(r.Context(), "store.Delete", key)
+	deleted := kvs.Delete(key)
+	end()
+	if !deleted {
+		sendJSONResponse(w, ErrorResponse{Code: CodeKeyNotFound, Error: "Key not found"}, http.StatusNotFound)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, map[string]string{"status": "OK"}, http.StatusOK)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// kvPath builds the /kv path for key, escaping each slash-separated segment
+// the way a client would.
+func kvPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return "/kv/" + strings.Join(segments, "/")
+}
+
+func TestKVPathKeys(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kv/{key...}", kvs.handleKV)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		target string
+		key    string
+	}{
+		{"/kv/a/b/c", "a/b/c"},
+		{kvPath("users/42/profile"), "users/42/profile"},
+		{kvPath("my key"), "my key"},
+		{"/kv/my+key", "my+key"},
+		{kvPath("日本/語"), "日本/語"},
+		{"/kv/" + "日本", "日本"},
+		{kvPath("100%/off"), "100%/off"},
+		{"/kv/a%2Fb", "a/b"},
+		{kvPath("q?x=1#frag"), "q?x=1#frag"},
+	}
+	for _, tt := range tests {
+		value := "value of " + tt.key
+		if rec := do(http.MethodPut, tt.target, value); rec.Code != http.StatusOK && rec.Code != http.StatusCreated {
+			t.Errorf("PUT %s: status %d: %s", tt.target, rec.Code, rec.Body)
+			continue
+		}
+		if got, ok := kvs.Get(tt.key); !ok || got != value {
+			t.Errorf("PUT %s stored %q (found %v) under %q, want %q", tt.target, got, ok, tt.key, value)
+		}
+
+		rec := do(http.MethodGet, tt.target, "")
+		var resp GetResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d: %s", tt.target, rec.Code, rec.Body)
+		} else if resp.Key != tt.key || resp.Value != value {
+			t.Errorf("GET %s = %q: %q, want %q: %q", tt.target, resp.Key, resp.Value, tt.key, value)
+		}
+
+		if rec := do(http.MethodDelete, tt.target, ""); rec.Code != http.StatusOK {
+			t.Errorf("DELETE %s: status %d: %s", tt.target, rec.Code, rec.Body)
+		}
+		if _, ok := kvs.Get(tt.key); ok {
+			t.Errorf("DELETE %s left %q in place", tt.target, tt.key)
+		}
+	}
+}
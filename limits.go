@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrValueTooLarge is returned when a value exceeds -max-value-bytes.
+var ErrValueTooLarge = errors.New("value too large")
+
+// ErrValueNotUTF8 is returned for a value that isn't valid UTF-8 when
+// -require-utf8 is set.
+var ErrValueNotUTF8 = errors.New("value is not valid UTF-8")
+
+// validateValue checks value against the configured size limit and, with
+// -require-utf8, its encoding. Values sent as JSON strings are always valid
+// UTF-8 by the time they get here, but a raw PUT /kv body, a range write
+// or a bitmap can hold any bytes. Those are stored safely (see
+// encodeValue), so -require-utf8 is for deployments whose clients only
+// expect text.
+func (kvs *KeyValueStore) validateValue(value string) error {
+	if limit := kvs.current().MaxValueBytes; limit > 0 && len(value) > limit {
+		return fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrValueTooLarge, len(value), limit)
+	}
+	if kvs.cfg.RequireUTF8 && !utf8.ValidString(value) {
+		return ErrValueNotUTF8
+	}
+	return nil
+}
+
+// maxValueExtent caps how far SetRange and SetBit can grow a value even
+// when -max-value-bytes is unset, as Redis caps SETRANGE and SETBIT offsets
+// at 512MB. Padding a value out to an offset allocates it under the write
+// lock, so without a cap one request could exhaust memory.
+const maxValueExtent = 512 << 20
+
+// checkExtent reports whether writing n bytes at offset keeps the value
+// within maxValueExtent and -max-value-bytes. The comparison is arranged so
+// that offset+n can't overflow.
+func (kvs *KeyValueStore) checkExtent(offset, n int) error {
+	limit := maxValueExtent
+	if l := kvs.current().MaxValueBytes; l > 0 && l < limit {
+		limit = l
+	}
+	if offset > limit-n {
+		return fmt.Errorf("%w: writing %d bytes at offset %d exceeds limit of %d", ErrValueTooLarge, n, offset, limit)
+	}
+	return nil
+}
+
+// setBodyKeyAllowance stands in for -max-key-bytes in maxSetBodyBytes when
+// only -max-value-bytes is set.
+const setBodyKeyAllowance = 1 << 20
+
+// maxSetBodyBytes bounds a /set request body, or returns -1 when neither
+// -max-key-bytes nor -max-value-bytes is set. When only one is set, the
+// other counts as setBodyKeyAllowance or maxValueExtent, so the body is
+// still bounded. JSON escaping can grow a string up to six times (\u00XX),
+// so allow for that on top of the key and value limits rather than
+// rejecting legitimate values early.
+func (kvs *KeyValueStore) maxSetBodyBytes() int64 {
+	cfg := kvs.current()
+	if cfg.MaxKeyBytes <= 0 && cfg.MaxValueBytes <= 0 {
+		return -1
+	}
+	keyBytes, valueBytes := int64(cfg.MaxKeyBytes), int64(cfg.MaxValueBytes)
+	if keyBytes <= 0 {
+		keyBytes = setBodyKeyAllowance
+	}
+	if valueBytes <= 0 {
+		valueBytes = maxValueExtent
+	}
+	return 6*(keyBytes+valueBytes) + 4096
+}
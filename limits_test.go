@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireUTF8(t *testing.T) {
+	invalid := "ok\xff\xfe"
+
+	cfg := testConfig(t)
+	cfg.RequireUTF8 = true
+	kvs := newTestStore(t, cfg)
+
+	if err := kvs.Set("k", invalid); !errors.Is(err, ErrValueNotUTF8) {
+		t.Errorf("Set of invalid UTF-8: %v, want ErrValueNotUTF8", err)
+	}
+	if err := kvs.Set("k", "héllo"); err != nil {
+		t.Errorf("Set of valid UTF-8: %v", err)
+	}
+
+	// A raw PUT /kv body is the way invalid bytes reach the store over HTTP.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kv/{key...}", kvs.handleKV)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kv/k", strings.NewReader(invalid)))
+	var resp ErrorResponse
+	if rec.Code != http.StatusBadRequest || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.Code != CodeInvalidValue {
+		t.Errorf("PUT /kv of invalid UTF-8: status %d: %s, want 400 %s", rec.Code, rec.Body, CodeInvalidValue)
+	}
+	if got, _ := kvs.Get("k"); got != "héllo" {
+		t.Errorf("k = %q after rejected writes, want héllo", got)
+	}
+
+	// Without the flag the same value is stored and survives a snapshot.
+	kvs = newTestStore(t, testConfig(t))
+	if err := kvs.Set("k", invalid); err != nil {
+		t.Fatalf("Set of invalid UTF-8 without -require-utf8: %v", err)
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("k"); got != invalid {
+		t.Errorf("k = %q after reload, want %q", got, invalid)
+	}
+}
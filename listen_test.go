@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDisplayAddr(t *testing.T) {
+	tests := map[string]string{
+		":8080":           "localhost:8080",
+		"[::1]:8080":      "[::1]:8080",
+		"[::]:8080":       "[::]:8080",
+		"127.0.0.1:8080":  "127.0.0.1:8080",
+		"[fe80::1%lo]:80": "[fe80::1%lo]:80",
+	}
+	for addr, want := range tests {
+		if got := displayAddr(addr); got != want {
+			t.Errorf("displayAddr(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+// TestServeIPv6Loopback listens on [::1] the way main does and does a set
+// and a get over it.
+func TestServeIPv6Loopback(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/set", kvs.handleSet)
+	mux.HandleFunc("/get", kvs.handleGet)
+
+	lc := net.ListenConfig{KeepAlive: kvs.cfg.TCPKeepAlive}
+	listener, err := lc.Listen(context.Background(), "tcp", "[::1]:0")
+	if err != nil {
+		t.Fatalf("listening on [::1]: %v", err)
+	}
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	base := "http://" + displayAddr(listener.Addr().String())
+	if !strings.HasPrefix(base, "http://[::1]:") {
+		t.Fatalf("listening on %s, want [::1]", listener.Addr())
+	}
+
+	resp, err := http.Post(base+"/set", "application/json", strings.NewReader(`{"key":"k","value":"v6"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/set: status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(base + "/get?key=k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got GetResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || got.Value != "v6" {
+		t.Errorf("/get: status %d, value %q, want 200 and v6", resp.StatusCode, got.Value)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// lockSuffix names the lock file beside the data file. It is held for as
+// long as a process owns the data file, so a second instance started in the
+// same directory can't interleave its saves with ours.
+const lockSuffix = ".lock"
+
+// ErrDataFileLocked is returned when another process holds the lock file.
+var ErrDataFileLocked = errors.New("data file is locked by another process")
+
+// acquireDataLock takes the lock on the lock file at path and records our PID
+// in it so the error seen by a second instance can say who holds it.
+func acquireDataLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFileExclusive(f); err != nil {
+		holder, _ := os.ReadFile(path)
+		f.Close()
+		if errors.Is(err, ErrDataFileLocked) {
+			if pid := strings.TrimSpace(string(holder)); pid != "" {
+				return nil, fmt.Errorf("%w (pid %s holds %s)", ErrDataFileLocked, pid, path)
+			}
+			return nil, fmt.Errorf("%w (%s)", ErrDataFileLocked, path)
+		}
+		return nil, err
+	}
+
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return f, nil
+}
+
+// releaseDataLock drops the lock taken by NewKeyValueStore. The file itself
+// is left in place; removing it would let a new instance lock a fresh file
+// while a slow process still holds the old one.
+func (kvs *KeyValueStore) releaseDataLock() {
+	if kvs.lock == nil {
+		return
+	}
+	kvs.lock.Truncate(0)
+	kvs.lock.Close()
+	kvs.lock = nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFileExclusive is a no-op where flock isn't available; the lock file
+// still records the PID but nothing enforces it.
+func lockFileExclusive(f *os.File) error {
+	return nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,7 +13,10 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -18,42 +24,348 @@ import (
 const (
 	httpPort = ":8080"
 	tcpPort  = ":8081"
-	dataFile = "kvstore.json"
-	syncInterval = 5 * time.Second
+	// defaultDataFile and defaultSyncInterval are the -data-file and
+	// -sync-interval defaults.
+	defaultDataFile = "kvstore.json"
+	defaultSyncInterval = 5 * time.Second
 )
 
 type KeyValueStore struct {
 	mu    sync.RWMutex
 	store map[string]string
 	dirty bool
+	cfg   Config
+
+	// saveMu ensures only one save runs at a time, so two saves can never
+	// race on the shared temp file.
+	saveMu sync.Mutex
+
+	// access is nil unless per-key access tracking is enabled.
+	access *accessTracker
+	// quotas is nil unless per-prefix key limits are configured.
+	quotas *prefixQuotas
+
+	watchers *watchRegistry
+	ops      opCounters
+	expiries *expiryQueue
+	// interner is nil unless value interning is enabled.
+	interner *internTable
+	sizes    sizeHistogram
+	// contentTypes holds the optional content type recorded for a key.
+	contentTypes map[string]string
+	// modified records when each key's value last changed, for
+	// newer_wins merges. Keys loaded without one have the zero time.
+	modified map[string]time.Time
+	// history holds recent values per key; nil unless -history is set.
+	history map[string]*keyHistory
+	// deletedHistory tracks the deleted keys still in history.
+	deletedHistory *deletedHistories
+	// valueIndex maps values to keys; nil unless -index-values is set.
+	valueIndex *valueIndex
+	// lru orders keys by recency; nil unless -max-keys evicts.
+	lru *lruTracker
+	// lock is the held lock file, released on shutdown.
+	lock *os.File
+	// saves rate-limits saves; nil unless -min-save-interval is set.
+	saves *saveDebouncer
+	// saveHealth records whether saves are currently failing.
+	saveHealth saveHealth
+	// wal logs mutations between snapshots; nil unless -wal is set.
+	wal *writeAheadLog
+	// changes streams mutations to stdout; nil unless -change-log is set.
+	changes *changeLog
+	// live holds the config as last reloaded on SIGHUP; see current.
+	live atomic.Pointer[Config]
 }
 
-func NewKeyValueStore() (*KeyValueStore, error) {
+func NewKeyValueStore(cfg Config) (*KeyValueStore, error) {
 	kvs := &KeyValueStore{
-		store: make(map[string]string),
+		store:    make(map[string]string, cfg.InitialCapacity),
+		cfg:      cfg,
+		watchers: newWatchRegistry(),
+		expiries: newExpiryQueue(),
+
+		contentTypes: make(map[string]string),
+		modified:     make(map[string]time.Time),
+	}
+	if cfg.ChangeLog {
+		kvs.changes = newChangeLog(os.Stdout)
+	}
+	if cfg.MinSaveInterval > 0 {
+		kvs.saves = newSaveDebouncer(cfg.MinSaveInterval)
+	}
+	if cfg.MaxKeys > 0 && cfg.OverflowMode == OverflowEvict {
+		kvs.lru = newLRUTracker()
+	}
+	if cfg.IndexValues {
+		kvs.valueIndex = newValueIndex()
+	}
+	if cfg.HistorySize > 0 {
+		kvs.history = make(map[string]*keyHistory)
+		kvs.deletedHistory = newDeletedHistories()
+	}
+	if cfg.TrackAccess {
+		kvs.access = newAccessTracker(cfg.AccessTrackerSize)
 	}
 	
+	if err := kvs.makeDataDirs(); err != nil {
+		return nil, err
+	}
+	lock, err := acquireDataLock(kvs.lockPath())
+	if err != nil {
+		return nil, err
+	}
+	kvs.lock = lock
+
 	if err := kvs.loadFromDisk(); err != nil {
+		kvs.releaseDataLock()
 		return nil, err
 	}
+	if cfg.WAL {
+		if err := kvs.openWAL(); err != nil {
+			kvs.releaseDataLock()
+			return nil, err
+		}
+	}
+
+	if cfg.InternValues {
+		kvs.interner = newInternTable()
+	}
+	if len(cfg.PrefixQuotas) > 0 {
+		kvs.quotas = newPrefixQuotas(cfg.PrefixQuotas)
+	}
+	kvs.rebuildDerivedLocked()
+
+	if cfg.SeedFile != "" {
+		if err := kvs.loadSeedFile(cfg.SeedFile, cfg.SeedOverwrite); err != nil {
+			kvs.releaseDataLock()
+			return nil, err
+		}
+	}
 	
 	return kvs, nil
 }
 
-func (kvs *KeyValueStore) Set(key, value string) {
+// rebuildDerivedLocked recomputes all state derived from the contents of
+// kvs.store. It must be called whenever the map is replaced wholesale
+// rather than through setLocked and deleteLocked. Callers must hold kvs.mu
+// for writing, or have exclusive access during construction.
+func (kvs *KeyValueStore) rebuildDerivedLocked() {
+	if kvs.interner != nil {
+		kvs.interner.rebuild(kvs.store)
+	}
+	if kvs.quotas != nil {
+		kvs.quotas.recount(kvs.store)
+	}
+	kvs.sizes.rebuild(kvs.store)
+	if kvs.valueIndex != nil {
+		kvs.valueIndex.rebuild(kvs.store)
+	}
+	if kvs.lru != nil {
+		kvs.lru.rebuild(kvs.store)
+	}
+}
+
+func (kvs *KeyValueStore) Set(key, value string) error {
+	key = kvs.normalizeKey(key)
 	kvs.mu.Lock()
 	defer kvs.mu.Unlock()
+	return kvs.setLocked(key, value)
+}
+
+// setLocked stores value under an already normalized key. Every write path
+// goes through here so per-write bookkeeping lives in one place. Callers must
+// hold kvs.mu for writing.
+func (kvs *KeyValueStore) setLocked(key, value string) error {
+	return kvs.setAtLocked(key, value, time.Now())
+}
+
+// setAtLocked is setLocked with the modification time recorded for the key
+// given explicitly, for merges that carry the source's time across.
+func (kvs *KeyValueStore) setAtLocked(key, value string, modified time.Time) error {
+	if err := kvs.validateKey(key); err != nil {
+		return err
+	}
+	if err := kvs.validateValue(value); err != nil {
+		return err
+	}
+
+	// A plain set makes the key persistent again, like Redis SET.
+	if kvs.expiries.remove(key) {
+		kvs.logPersistLocked(key)
+		kvs.dirty = true
+	}
+
+	current, exists := kvs.store[key]
+	if !exists {
+		if err := kvs.checkCapacityLocked(key); err != nil {
+			return err
+		}
+		if kvs.quotas != nil {
+			if err := kvs.checkQuotaLocked(key); err != nil {
+				return err
+			}
+			kvs.quotas.add(key, 1)
+		}
+		if kvs.lru != nil {
+			kvs.makeRoomLocked()
+		}
+	}
+	kvs.ops.sets.Add(1)
+	kvs.recordAccess(key, true)
+	kvs.touchKey(key)
+
+	if exists && current == value {
+		// Rewriting the same value changes nothing, so don't mark the
+		// store dirty or wake watchers.
+		return nil
+	}
+	// The old content type describes the old value, so drop it.
+	kvs.setContentTypeLocked(key, "")
+	if exists {
+		kvs.sizes.add(current, -1)
+	}
+	kvs.sizes.add(value, 1)
+	if kvs.interner != nil {
+		if exists {
+			kvs.interner.release(current)
+		}
+		value = kvs.interner.acquire(value)
+	}
+	if kvs.valueIndex != nil {
+		if exists {
+			kvs.valueIndex.remove(current, key)
+		}
+		kvs.valueIndex.add(value, key)
+	}
 	kvs.store[key] = value
+	kvs.modified[key] = modified
+	kvs.logSetLocked(key, value)
+	kvs.recordChange(walOpSet, key)
+	kvs.recordHistoryLocked(key, value, time.Now())
+	kvs.dirty = true
+	kvs.watchers.notify(key)
+	return nil
+}
+
+// updateLocked is setLocked for operations that edit a value in place, such
+// as appends and range writes: the key keeps its TTL and content type
+// instead of being reset like a plain set. Callers must hold kvs.mu for
+// writing.
+func (kvs *KeyValueStore) updateLocked(key, value string) error {
+	return kvs.keepMetaLocked(key, func() error { return kvs.setLocked(key, value) })
+}
+
+// keepMetaLocked runs set, a write of key, and restores the TTL and content
+// type the key had beforehand. A key that has expired but not yet been
+// swept is treated as missing, as its callers treat its value: the write
+// creates a fresh key, and restoring the past expiry would make it vanish
+// again at once. Callers must hold kvs.mu for writing.
+func (kvs *KeyValueStore) keepMetaLocked(key string, set func() error) error {
+	_, live := kvs.lookupLocked(key, time.Now())
+	expiresAt, hasTTL := kvs.expiries.get(key)
+	contentType := kvs.contentTypes[key]
+	if err := set(); err != nil {
+		return err
+	}
+	if !live {
+		return nil
+	}
+	if hasTTL {
+		kvs.expiries.set(key, expiresAt)
+		kvs.logExpireLocked(key, expiresAt)
+	}
+	kvs.setContentTypeLocked(key, contentType)
+	return nil
+}
+
+// deleteLocked removes an already normalized key and reports whether it was
+// present. Callers must hold kvs.mu for writing.
+func (kvs *KeyValueStore) deleteLocked(key string) bool {
+	value, ok := kvs.store[key]
+	if !ok {
+		return false
+	}
+	delete(kvs.store, key)
+	kvs.logDeleteLocked(key)
+	kvs.recordChange(walOpDel, key)
+	delete(kvs.contentTypes, key)
+	delete(kvs.modified, key)
+	kvs.recordDeleteHistoryLocked(key, time.Now())
+	kvs.sizes.add(value, -1)
+	if kvs.interner != nil {
+		kvs.interner.release(value)
+	}
+	if kvs.valueIndex != nil {
+		kvs.valueIndex.remove(value, key)
+	}
+	if kvs.lru != nil {
+		kvs.lru.remove(key)
+	}
+	kvs.expiries.remove(key)
+	if kvs.quotas != nil {
+		kvs.quotas.add(key, -1)
+	}
 	kvs.dirty = true
+	kvs.ops.deletes.Add(1)
+	kvs.recordAccess(key, true)
+	kvs.watchers.notify(key)
+	return true
+}
+
+// Swap stores value under key and returns the value it replaced, if any.
+// A non-empty contentType is recorded alongside the value.
+func (kvs *KeyValueStore) Swap(key, value, contentType string) (string, bool, error) {
+	return kvs.SwapIfMatch(key, value, contentType, "")
+}
+
+// SwapIfMatch is Swap guarded by an If-Match header value: unless ifMatch
+// is empty, the write only happens if the current value's ETag matches it
+// and otherwise fails with ErrPreconditionFailed. "*" matches any existing
+// value.
+func (kvs *KeyValueStore) SwapIfMatch(key, value, contentType, ifMatch string) (string, bool, error) {
+	if err := validateContentType(contentType); err != nil {
+		return "", false, err
+	}
+
+	key = kvs.normalizeKey(key)
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	old, existed := kvs.lookupLocked(key, time.Now())
+	if ifMatch != "" && (!existed || !etagMatches(ifMatch, valueETag(old))) {
+		return old, existed, ErrPreconditionFailed
+	}
+	if err := kvs.setLocked(key, value); err != nil {
+		return "", false, err
+	}
+	kvs.setContentTypeLocked(key, contentType)
+	return old, existed, nil
 }
 
 func (kvs *KeyValueStore) Get(key string) (string, bool) {
+	key = kvs.normalizeKey(key)
 	kvs.mu.RLock()
 	defer kvs.mu.RUnlock()
-	value, ok := kvs.store[key]
+	value, ok := kvs.lookupLocked(key, time.Now())
+	kvs.ops.gets.Add(1)
+	kvs.recordAccess(key, false)
+	if ok {
+		kvs.touchKey(key)
+	}
 	return value, ok
 }
 
+// Delete removes key and reports whether it existed.
+func (kvs *KeyValueStore) Delete(key string) bool {
+	key = kvs.normalizeKey(key)
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	// An expired key that hasn't been swept yet is removed, but reported
+	// as missing just as a read would.
+	expired := kvs.expiries.expired(key, time.Now())
+	return kvs.deleteLocked(key) && !expired
+}
+
 func (kvs *KeyValueStore) Count() int {
 	kvs.mu.RLock()
 	defer kvs.mu.RUnlock()
@@ -61,18 +373,52 @@ func (kvs *KeyValueStore) Count() int {
 }
 
 func (kvs *KeyValueStore) loadFromDisk() error {
-	file, err := os.Open(dataFile)
-	if os.IsNotExist(err) {
-		return nil // File doesn't exist, start with empty store
-	} else if err != nil {
+	data, err := os.ReadFile(kvs.dataPath())
+	if err != nil && !os.IsNotExist(err) {
+		if kvs.loadMirror(err) {
+			return nil
+		}
 		return err
 	}
-	defer file.Close()
 
-	return json.NewDecoder(file).Decode(&kvs.store)
+	// A missing file, or an empty or whitespace-only one (e.g. after a
+	// truncated write or a touch), holds no data, so treat it as an empty
+	// store unless the mirror has a copy.
+	if len(bytes.TrimSpace(data)) == 0 {
+		kvs.loadMirror(nil)
+		return nil
+	}
+
+	// decodeSnapshot decodes into the existing map, so -initial-capacity
+	// pre-sizing carries over to the loaded store.
+	if err := decodeSnapshot(data, kvs.store); err != nil {
+		if kvs.loadMirror(err) {
+			return nil
+		}
+		return kvs.recoverFromBackup(err)
+	}
+	kvs.loadMeta(kvs.metaPath())
+	return nil
 }
 
 func (kvs *KeyValueStore) saveToDisk() error {
+	kvs.saveMu.Lock()
+	defer kvs.saveMu.Unlock()
+	return kvs.writeSnapshot()
+}
+
+// trySaveToDisk saves like saveToDisk unless another save is already in
+// progress, in which case it returns false without waiting.
+func (kvs *KeyValueStore) trySaveToDisk() (bool, error) {
+	if !kvs.saveMu.TryLock() {
+		return false, nil
+	}
+	defer kvs.saveMu.Unlock()
+	return true, kvs.writeSnapshot()
+}
+
+// writeSnapshot writes the store to the data file. Callers must hold saveMu.
+func (kvs *KeyValueStore) writeSnapshot() error {
 	kvs.mu.Lock()
 	defer kvs.mu.Unlock()
 
@@ -80,43 +426,114 @@ func (kvs *KeyValueStore) saveToDisk() error {
 		return nil // No changes to save
 	}
 
-	tempFile := dataFile + ".tmp"
+	fsync := kvs.cfg.FsyncPolicy != FsyncNever
+	data, meta := kvs.snapshotLocked()
+	if err := writeJSONFile(kvs.dataPath(), data, fsync); err != nil {
+		kvs.saveHealth.record(err)
+		return err
+	}
+	if kvs.cfg.MirrorFile != "" {
+		// The store stays dirty if the mirror can't be written, so the
+		// next save retries both copies and /health reports the failure.
+		if err := writeJSONFile(kvs.cfg.MirrorFile, data, fsync); err != nil {
+			kvs.saveHealth.record(err)
+			return err
+		}
+	}
+	if err := writeJSONFile(kvs.metaPath(), meta, fsync); err != nil {
+		kvs.saveHealth.record(err)
+		return err
+	}
+	if kvs.cfg.MirrorFile != "" {
+		if err := writeJSONFile(metaPathFor(kvs.cfg.MirrorFile), meta, fsync); err != nil {
+			kvs.saveHealth.record(err)
+			return err
+		}
+	}
+
+	kvs.dirty = false
+	kvs.saveHealth.record(nil)
+	if kvs.wal != nil {
+		// Everything logged so far is in the snapshot now.
+		if err := kvs.wal.reset(); err != nil {
+			log.Printf("Error truncating %s: %v", kvs.walPath(), err)
+		}
+	}
+	return nil
+}
+
+// writeJSONFile atomically replaces path with the JSON encoding of v by
+// writing a temp file and then renaming it into place. When fsync is set the
+// temp file is synced before the rename.
+// encoding/json writes map keys in sorted order, so the same data always
+// produces the same bytes, which keeps snapshots diffable and lets backup
+// tools deduplicate them.
+func writeJSONFile(path string, v interface{}, fsync bool) (err error) {
+	tempFile := path + ".tmp"
 	file, err := os.Create(tempFile)
 	if err != nil {
 		return err
 	}
+	// A failed write (typically ENOSPC) must not leave a partial temp file
+	// taking up the space the next attempt needs.
+	defer func() {
+		if err != nil {
+			os.Remove(tempFile)
+		}
+	}()
 
-	if err := json.NewEncoder(file).Encode(kvs.store); err != nil {
+	if err := json.NewEncoder(file).Encode(v); err != nil {
 		file.Close()
 		return err
 	}
 
-	if err := file.Sync(); err != nil {
-		file.Close()
-		return err
+	if fsync {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
 	}
 
 	if err := file.Close(); err != nil {
 		return err
 	}
 
-	if err := os.Rename(tempFile, dataFile); err != nil {
-		return err
-	}
+	return os.Rename(tempFile, path)
+}
 
-	kvs.dirty = false
-	return nil
+// persistWrite is called by handlers after a successful write, before the
+// client is answered. Under the always fsync policy it saves immediately so
+// the acknowledgement implies durability, traced as a span under the request
+// in ctx; otherwise the sync routine picks the change up later.
+func (kvs *KeyValueStore) persistWrite(ctx context.Context) error {
+	if kvs.cfg.FsyncPolicy != FsyncAlways {
+		return nil
+	}
+	defer startSpan(ctx, "store.persist", "")()
+	if kvs.wal != nil {
+		return kvs.wal.waitDurable(kvs.wal.lastSeq())
+	}
+	return kvs.requestSave()
 }
 
 func (kvs *KeyValueStore) startSyncRoutine(ctx context.Context) {
-	ticker := time.NewTicker(syncInterval)
+	ticker := time.NewTicker(kvs.cfg.SyncInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			if err := kvs.saveToDisk(); err != nil {
+			if kvs.saves != nil {
+				if err := kvs.requestSave(); err != nil {
+					log.Printf("Error saving to disk: %v", err)
+				}
+				continue
+			}
+			saved, err := kvs.trySaveToDisk()
+			if err != nil {
 				log.Printf("Error saving to disk: %v", err)
+			} else if !saved {
+				log.Printf("Previous save still in progress, skipping sync tick")
 			}
 		case <-ctx.Done():
 			if err := kvs.saveToDisk(); err != nil {
@@ -128,7 +545,25 @@ func (kvs *KeyValueStore) startSyncRoutine(ctx context.Context) {
 }
 
 func main() {
-	kvs, err := NewKeyValueStore()
+	cfg, err := parseConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.HashAPIKey {
+		if err := runHashAPIKey(); err != nil {
+			log.Fatalf("Error hashing API key: %v", err)
+		}
+		return
+	}
+
+	keys, err := loadAPIKeys(cfg.CredentialsFile)
+	if err != nil {
+		log.Fatalf("Error loading API keys: %v", err)
+	}
+	apiKeys := new(apiKeyStore)
+	apiKeys.Store(keys)
+
+	kvs, err := NewKeyValueStore(cfg)
 	if err != nil {
 		log.Fatalf("Error creating key-value store: %v", err)
 	}
@@ -137,30 +572,122 @@ func main() {
 	defer cancel()
 	
 	go kvs.startSyncRoutine(ctx)
+	go kvs.startExpiryRoutine(ctx)
+	if cfg.BackupInterval > 0 {
+		go kvs.startBackupRoutine(ctx)
+	}
+	if len(cfg.FlushSchedules) > 0 {
+		go kvs.startFlushScheduler(ctx)
+	}
+	if cfg.PprofAddr != "" {
+		go startPprofServer(cfg.PprofAddr)
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/set", kvs.handleSet)
+	mux.HandleFunc("/new", kvs.handleNew)
 	mux.HandleFunc("/get", kvs.handleGet)
+	mux.HandleFunc("/delete", kvs.handleDelete)
+	mux.HandleFunc("/bulk_delete", kvs.handleBulkDelete)
 	mux.HandleFunc("/count", kvs.handleCount)
+	mux.HandleFunc("/keys", kvs.handleScan)
+	mux.HandleFunc("/randomkey", kvs.handleRandomKey)
+	mux.HandleFunc("/dump", kvs.handleDump)
+	mux.HandleFunc("/replace", kvs.handleReplace)
+	mux.HandleFunc("/hotkeys", kvs.handleHotKeys)
+	mux.HandleFunc("/txn", kvs.handleTxn)
+	mux.HandleFunc("/multi_cas", kvs.handleMultiCAS)
+	mux.HandleFunc("/admin/compact", kvs.handleCompact)
+	mux.HandleFunc("/admin/rekey", kvs.handleRekey)
+	mux.HandleFunc("/admin/verify", kvs.handleVerify)
+	mux.HandleFunc("/admin/flush_expired", kvs.handleFlushExpired)
+	mux.HandleFunc("/admin/api_keys", apiKeys.handleList)
+	mux.HandleFunc("/ui", apiKeys.handleUI)
+	mux.HandleFunc("/watch", kvs.handleWatch)
+	mux.HandleFunc("/shard_info", kvs.handleShardInfo)
+	mux.HandleFunc("/expire_prefix", kvs.handleExpirePrefix)
+	mux.HandleFunc("/expiring", kvs.handleExpiring)
+	mux.HandleFunc("/ttl", kvs.handleTTL)
+	mux.HandleFunc("/stats", kvs.handleStats)
+	mux.HandleFunc("/stats/value_sizes", kvs.handleValueSizes)
+	mux.HandleFunc("/consistent_get", kvs.handleConsistentGet)
+	mux.HandleFunc("/raw/{key...}", kvs.handleRaw)
+	mux.HandleFunc("/kv/{key...}", kvs.handleKV)
+	mux.HandleFunc("/merge", kvs.handleMerge)
+	mux.HandleFunc("/history", kvs.handleHistory)
+	mux.HandleFunc("/find_by_value", kvs.handleFindByValue)
+	mux.HandleFunc("/set_many_ttl", kvs.handleSetManyTTL)
+	mux.HandleFunc("/batch_set", kvs.handleBatchSet)
+	mux.HandleFunc("/append_json", kvs.handleAppendJSON)
+	mux.HandleFunc("/setrange", kvs.handleSetRange)
+	mux.HandleFunc("/getrange", kvs.handleGetRange)
+	mux.HandleFunc("/strlen", kvs.handleStrLen)
+	mux.HandleFunc("/setbit", kvs.handleSetBit)
+	mux.HandleFunc("/getbit", kvs.handleGetBit)
+	mux.HandleFunc("/bitcount", kvs.handleBitCount)
+	mux.HandleFunc("/health", kvs.handleHealth)
+	mux.HandleFunc("/debug/keys", kvs.handleSampleKeys)
+	if cfg.Expvar {
+		kvs.publishExpvar()
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
 
-	server := &http.Server{Addr: httpPort, Handler: mux}
+	// The auth middleware is always installed so a config reload can turn
+	// authentication on; it passes everything through while no keys are set.
+	var handler http.Handler = apiKeys.authMiddleware(mux)
+	if keys != nil {
+		fmt.Printf("API key authentication enabled (%d keys)\n", len(keys.hashes))
+	}
+	if cfg.SlowThreshold > 0 {
+		handler = slowRequestMiddleware(handler, cfg.SlowThreshold)
+	}
+	if tracer := newTraceExporterFromEnv(); tracer != nil {
+		go tracer.run(ctx)
+		handler = tracer.tracingMiddleware(handler)
+		fmt.Printf("Exporting traces to %s\n", tracer.endpoint)
+	}
+
+	server := &http.Server{
+		Addr:        cfg.HTTPAddr,
+		Handler:     handler,
+		IdleTimeout: cfg.IdleTimeout,
+	}
+	server.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
+	if cfg.H2C {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		server.Protocols = protocols
+		fmt.Println("HTTP/2 cleartext (h2c) enabled")
+	}
 
 	// Start the HTTP server in a goroutine
 	go func() {
-		fmt.Printf("HTTP server starting on http://localhost%s\n", httpPort)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		// The listen backlog is taken from the kernel (net.core.somaxconn on
+		// Linux); only the TCP keep-alive period is tunable from here.
+		lc := net.ListenConfig{KeepAlive: cfg.TCPKeepAlive}
+		listener, err := lc.Listen(context.Background(), "tcp", cfg.HTTPAddr)
+		if err != nil {
+			log.Fatalf("HTTP listener error: %v", err)
+		}
+		if cfg.MaxConnsPerIP > 0 {
+			listener = newPerIPListener(listener, cfg.MaxConnsPerIP)
+		}
+
+		fmt.Printf("HTTP server starting on http://%s\n", displayAddr(cfg.HTTPAddr))
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP server error: %v", err)
 		}
 	}()
 
 	// Start TCP listener for shutdown in a goroutine
 	go func() {
-		listener, err := net.Listen("tcp", tcpPort)
+		listener, err := net.Listen("tcp", cfg.TCPAddr)
 		if err != nil {
 			log.Fatalf("TCP listener error: %v", err)
 		}
 		defer listener.Close()
-		fmt.Printf("TCP shutdown listener started on port%s\n", tcpPort)
+		fmt.Printf("TCP shutdown listener started on %s\n", displayAddr(cfg.TCPAddr))
 
 		_, err = listener.Accept()
 		if err != nil {
@@ -168,113 +695,369 @@ func main() {
 			return
 		}
 		fmt.Println("Shutdown signal received via TCP")
-		gracefulShutdown(server)
+		gracefulShutdown(server, kvs)
 	}()
 
+	if cfg.ConfigFile != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := kvs.reloadConfig(apiKeys); err != nil {
+					log.Printf("Config reload failed, keeping current settings: %v", err)
+				}
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	fmt.Println("Shutdown signal received")
 	cancel() // Stop the sync routine
-	gracefulShutdown(server)
+	gracefulShutdown(server, kvs)
 }
 
 type SetRequest struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	// ContentType optionally records the media type /raw serves the
+	// value with.
+	ContentType string `json:"content_type,omitempty"`
 }
 
+// SetResponse confirms a write. Checksum is the SHA-256 of the stored value.
+type SetResponse struct {
+	Status   string `json:"status"`
+	Checksum string `json:"checksum"`
+}
+
+// SetOldResponse is returned by /set when return_old is requested. Existed
+// distinguishes a previous empty value from no previous value. OldEncoding
+// is set as in GetResponse.
+type SetOldResponse struct {
+	SetResponse
+	OldValue    string `json:"old_value"`
+	OldEncoding string `json:"old_encoding,omitempty"`
+	Existed     bool   `json:"existed"`
+}
+
+type DeleteRequest struct {
+	Key string `json:"key"`
+}
+
+// GetResponse is the body of a successful /get. A missing key is a 404
+// with an ErrorResponse, never a GetResponse, so Found is always true here;
+// it is spelled out so clients can tell an empty value from a miss without
+// relying on the status code. When Path is set, Value is the JSON encoding
+// of that part of the stored document. A value that isn't valid UTF-8 is
+// sent base64-encoded with Encoding set to "base64".
 type GetResponse struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Found    bool   `json:"found"`
+	Checksum string `json:"checksum,omitempty"`
 }
 
 type CountResponse struct {
 	Count int `json:"count"`
 }
 
+// Error codes returned in ErrorResponse.Code. Clients should match on these
+// rather than on the human-readable message, which may change.
+const (
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	CodeInvalidBody      = "INVALID_BODY"
+	CodeInvalidJSON      = "INVALID_JSON"
+	CodeInvalidRequest   = "INVALID_REQUEST"
+	CodeInvalidParameter = "INVALID_PARAMETER"
+	CodeMissingKey       = "MISSING_KEY"
+	CodeInvalidKey       = "INVALID_KEY"
+	CodeKeyNotFound      = "KEY_NOT_FOUND"
+	CodeQuotaExceeded    = "QUOTA_EXCEEDED"
+	CodeValueTooLarge    = "VALUE_TOO_LARGE"
+	CodeInvalidValue     = "INVALID_VALUE"
+	CodeStoreFull        = "STORE_FULL"
+	CodeValueNotJSON     = "VALUE_NOT_JSON"
+	CodePathNotFound     = "PATH_NOT_FOUND"
+	CodeVersionConflict  = "VERSION_CONFLICT"
+	CodeDuplicateKey     = "DUPLICATE_KEY"
+	CodeUnknownOperation = "UNKNOWN_OPERATION"
+	CodeFeatureDisabled  = "FEATURE_DISABLED"
+	CodeUnauthorized     = "UNAUTHORIZED"
+	CodeForbidden        = "FORBIDDEN"
+	CodeTooManyAttempts  = "TOO_MANY_ATTEMPTS"
+	CodeInternal         = "INTERNAL_ERROR"
+)
+
 type ErrorResponse struct {
+	Code  string `json:"code"`
 	Error string `json:"error"`
 }
 
 func (kvs *KeyValueStore) handleSet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		sendJSONResponse(w, ErrorResponse{Error: "Method not allowed"}, http.StatusMethodNotAllowed)
+		sendMethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
+	if limit := kvs.maxSetBodyBytes(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
 	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		sendJSONResponse(w, ErrorResponse{Error: "Error reading request body"}, http.StatusBadRequest)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeValueTooLarge, Error: "Request body too large"}, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
 		return
 	}
 
 	var req SetRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		sendJSONResponse(w, ErrorResponse{Error: "Error parsing JSON"}, http.StatusBadRequest)
+	if err := decodeStrictJSON(body, &req); errors.Is(err, errDuplicateJSONKey) || errors.Is(err, errTrailingJSON) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: err.Error()}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
 		return
 	}
 
-	if req.Key == "" {
-		sendJSONResponse(w, ErrorResponse{Error: "Missing key"}, http.StatusBadRequest)
+	if kvs.normalizeKey(req.Key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
 		return
 	}
 
-	kvs.Set(req.Key, req.Value)
-	sendJSONResponse(w, map[string]string{"status": "OK"}, http.StatusOK)
+	end := startSpan(r.Context(), "store.Set", req.Key)
+	old, existed, err := kvs.SwapIfMatch(req.Key, req.Value, req.ContentType, r.Header.Get("If-Match"))
+	end()
+	if errors.Is(err, ErrPreconditionFailed) {
+		if existed {
+			w.Header().Set("ETag", valueETag(old))
+		}
+		sendJSONResponse(w, ErrorResponse{Code: CodeVersionConflict, Error: err.Error()}, http.StatusConflict)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+
+	// The new ETag lets a client chain the next If-Match write without
+	// reading the value back.
+	w.Header().Set("ETag", valueETag(req.Value))
+	response := SetResponse{Status: "OK", Checksum: valueChecksum(req.Value)}
+	if returnOld, _ := strconv.ParseBool(r.URL.Query().Get("return_old")); returnOld {
+		encoded, encoding := encodeValue(old)
+		sendJSONResponse(w, SetOldResponse{SetResponse: response, OldValue: encoded, OldEncoding: encoding, Existed: existed}, http.StatusOK)
+		return
+	}
+	sendJSONResponse(w, response, http.StatusOK)
 }
 
 func (kvs *KeyValueStore) handleGet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		sendJSONResponse(w, ErrorResponse{Error: "Method not allowed"}, http.StatusMethodNotAllowed)
+		sendMethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
-	key := r.URL.Query().Get("key")
-	if key == "" {
-		sendJSONResponse(w, ErrorResponse{Error: "Missing key"}, http.StatusBadRequest)
+	kvs.serveGet(w, r, r.URL.Query().Get("key"))
+}
+
+// serveGet answers a read of key for both /get and GET /kv/{key...}.
+func (kvs *KeyValueStore) serveGet(w http.ResponseWriter, r *http.Request, key string) {
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+	if err := kvs.validateReadKey(kvs.normalizeKey(key)); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidKey, Error: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
+	end := startSpan(r.Context(), "store.Get", key)
 	value, ok := kvs.Get(key)
+	end()
 	if !ok {
-		sendJSONResponse(w, ErrorResponse{Error: "Key not found"}, http.StatusNotFound)
+		sendJSONResponse(w, ErrorResponse{Code: CodeKeyNotFound, Error: "Key not found"}, http.StatusNotFound)
+		return
+	}
+
+	// ?path= narrows a JSON value down to one field; everything below,
+	// including the ETag, then describes the projected value.
+	path := r.URL.Query().Get("path")
+	if path != "" {
+		projected, err := projectJSON(value, path)
+		switch {
+		case errors.Is(err, errValueNotJSON):
+			sendJSONResponse(w, ErrorResponse{Code: CodeValueNotJSON, Error: err.Error()}, http.StatusUnprocessableEntity)
+			return
+		case errors.Is(err, errPathNotFound):
+			sendJSONResponse(w, ErrorResponse{Code: CodePathNotFound, Error: err.Error()}, http.StatusNotFound)
+			return
+		case err != nil:
+			log.Printf("Error projecting value: %v", err)
+			kvs.sendInternalError(w, "Error projecting value", err)
+			return
+		}
+		value = projected
+	}
+
+	kvs.setCacheHeaders(w, key)
+	etag := valueETag(value)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if negotiateContentType(r) == contentTypeText {
+		sendTextResponse(w, value, http.StatusOK)
 		return
 	}
 
+	encoded, encoding := encodeValue(value)
 	response := GetResponse{
-		Key:   key,
-		Value: value,
+		Key:      kvs.normalizeKey(key),
+		Value:    encoded,
+		Encoding: encoding,
+		Path:     path,
+		Found:    true,
+	}
+	if withChecksum, _ := strconv.ParseBool(r.URL.Query().Get("checksum")); withChecksum {
+		response.Checksum = valueChecksum(value)
 	}
 	sendJSONResponse(w, response, http.StatusOK)
 }
 
+func (kvs *KeyValueStore) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req DeleteRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if kvs.normalizeKey(req.Key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	end := startSpan(r.Context(), "store.Delete", req.Key)
+	deleted := kvs.Delete(req.Key)
+	end()
+	if !deleted {
+		sendJSONResponse(w, ErrorResponse{Code: CodeKeyNotFound, Error: "Key not found"}, http.StatusNotFound)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, map[string]string{"status": "OK"}, http.StatusOK)
+}
+
 func (kvs *KeyValueStore) handleCount(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		sendJSONResponse(w, ErrorResponse{Error: "Method not allowed"}, http.StatusMethodNotAllowed)
+		sendMethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
 	count := kvs.Count()
+	if negotiateContentType(r) == contentTypeText {
+		sendTextResponse(w, strconv.Itoa(count)+"\n", http.StatusOK)
+		return
+	}
+
 	response := CountResponse{Count: count}
 	sendJSONResponse(w, response, http.StatusOK)
 }
 
+// sendWriteError reports an error returned by a store write method, mapping
+// known store errors to their status and code.
+func sendWriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPrefixQuotaExceeded):
+		sendJSONResponse(w, ErrorResponse{Code: CodeQuotaExceeded, Error: err.Error()}, http.StatusInsufficientStorage)
+	case errors.Is(err, ErrStoreFull):
+		sendJSONResponse(w, ErrorResponse{Code: CodeStoreFull, Error: err.Error()}, http.StatusInsufficientStorage)
+	case errors.Is(err, ErrValueTooLarge):
+		sendJSONResponse(w, ErrorResponse{Code: CodeValueTooLarge, Error: err.Error()}, http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrValueNotUTF8):
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidValue, Error: err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidContentType):
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidKey):
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidKey, Error: err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, ErrDuplicateKey):
+		sendJSONResponse(w, ErrorResponse{Code: CodeDuplicateKey, Error: err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, ErrTTLTooLong):
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: err.Error()}, http.StatusBadRequest)
+	default:
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidRequest, Error: err.Error()}, http.StatusBadRequest)
+	}
+}
+
 func sendJSONResponse(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(data)
 }
 
-func gracefulShutdown(server *http.Server) {
+// sendInternalError answers a request that failed because of err, an error
+// on the server's side such as a failed save. Clients only get msg, since
+// err may name files or other internals, unless -verbose-errors is set;
+// callers log err for operators.
+func (kvs *KeyValueStore) sendInternalError(w http.ResponseWriter, msg string, err error) {
+	if kvs.cfg.VerboseErrors {
+		msg += ": " + err.Error()
+	}
+	sendJSONResponse(w, ErrorResponse{Code: CodeInternal, Error: msg}, http.StatusInternalServerError)
+}
+
+// sendMethodNotAllowed answers a request whose method the endpoint doesn't
+// support, listing the methods it does in the Allow header as RFC 9110
+// requires.
+func sendMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	sendJSONResponse(w, ErrorResponse{Code: CodeMethodNotAllowed, Error: "Method not allowed"}, http.StatusMethodNotAllowed)
+}
+
+// gracefulShutdown drains in-flight requests for up to cfg.ShutdownTimeout,
+// then makes a final save before exiting. Hitting the timeout only cuts the
+// remaining connections; it doesn't skip the save.
+func gracefulShutdown(server *http.Server, kvs *KeyValueStore) {
 	fmt.Println("Server is shutting down...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), kvs.cfg.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown after %v: %v", kvs.cfg.ShutdownTimeout, err)
+		server.Close()
+	}
+
+	if err := kvs.saveToDisk(); err != nil {
+		log.Printf("Error saving to disk during shutdown: %v", err)
 	}
+	kvs.releaseDataLock()
 
 	fmt.Println("Server exiting")
 	os.Exit(0)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns the flag defaults the store depends on, with the data
+// directory in a fresh temporary directory.
+func testConfig(t testing.TB) Config {
+	t.Helper()
+	return Config{
+		DataDir:           t.TempDir(),
+		DataFile:          defaultDataFile,
+		SyncInterval:      defaultSyncInterval,
+		BackupDir:         t.TempDir(),
+		BackupRetainCount: 24,
+		FsyncPolicy:       FsyncInterval,
+		AccessTrackerSize: 10000,
+		OverflowMode:      OverflowReject,
+		MaxTTLMode:        TTLCapClamp,
+		BatchDuplicates:   DuplicatesReject,
+		ShutdownTimeout:   5 * time.Second,
+	}
+}
+
+// newTestStore opens a store for cfg and releases its data directory lock
+// when the test ends.
+func newTestStore(t testing.TB, cfg Config) *KeyValueStore {
+	t.Helper()
+	kvs, err := NewKeyValueStore(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyValueStore: %v", err)
+	}
+	t.Cleanup(kvs.releaseDataLock)
+	return kvs
+}
+
+// serve sends a request with an optional body to handler and returns the
+// recorded response.
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// reopen simulates a restart: it waits for kvs's logged writes to reach the
+// disk, without saving a snapshot, and opens a new store on the same data
+// directory.
+func reopen(t testing.TB, kvs *KeyValueStore) *KeyValueStore {
+	t.Helper()
+	if kvs.wal != nil {
+		if err := kvs.wal.waitDurable(kvs.wal.lastSeq()); err != nil {
+			t.Fatalf("waiting for the WAL: %v", err)
+		}
+	}
+	kvs.releaseDataLock()
+	return newTestStore(t, kvs.cfg)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Overflow modes decide what a write of a new key does once -max-keys is
+// reached.
+const (
+	// OverflowReject fails the write; updates to existing keys still work.
+	OverflowReject = "reject"
+	// OverflowEvict makes room by deleting the least recently used key.
+	OverflowEvict = "evict"
+)
+
+// ErrStoreFull is returned when a new key would exceed -max-keys in reject
+// mode.
+var ErrStoreFull = errors.New("store is full")
+
+// lruTracker orders keys from most to least recently used. Reads update it
+// under kvs.mu's read lock, so it has its own mutex like accessTracker.
+type lruTracker struct {
+	mu    sync.Mutex
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newLRUTracker() *lruTracker {
+	return &lruTracker{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+// touch marks key as the most recently used.
+func (t *lruTracker) touch(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.elems[key]; ok {
+		t.order.MoveToFront(elem)
+		return
+	}
+	t.elems[key] = t.order.PushFront(key)
+}
+
+func (t *lruTracker) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.elems[key]; ok {
+		t.order.Remove(elem)
+		delete(t.elems, key)
+	}
+}
+
+// oldest returns the least recently used key.
+func (t *lruTracker) oldest() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elem := t.order.Back()
+	if elem == nil {
+		return "", false
+	}
+	return elem.Value.(string), true
+}
+
+// rebuild tracks every key in store. Their relative order is arbitrary,
+// since recency isn't persisted.
+func (t *lruTracker) rebuild(store map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.order.Init()
+	t.elems = make(map[string]*list.Element, len(store))
+	for key := range store {
+		t.elems[key] = t.order.PushFront(key)
+	}
+}
+
+// touchKey records a use of key for LRU eviction when it is enabled.
+func (kvs *KeyValueStore) touchKey(key string) {
+	if kvs.lru != nil {
+		kvs.lru.touch(key)
+	}
+}
+
+// checkCapacityLocked reports whether the given keys can be created without
+// exceeding -max-keys in reject mode. Only creating a key can fail: keys
+// that already exist don't grow the store, so updating them always
+// succeeds at capacity. Evict mode always has room. Callers must hold
+// kvs.mu for writing.
+func (kvs *KeyValueStore) checkCapacityLocked(keys ...string) error {
+	if kvs.cfg.MaxKeys == 0 || kvs.cfg.OverflowMode != OverflowReject {
+		return nil
+	}
+	if kvs.fitsLocked(keys) {
+		return nil
+	}
+	// Expired keys the sweeper hasn't reached yet still take up slots;
+	// drop them before turning a new key away.
+	if kvs.sweepExpiredLocked(time.Now()) > 0 && kvs.fitsLocked(keys) {
+		return nil
+	}
+	return fmt.Errorf("%w: limit is %d keys", ErrStoreFull, kvs.cfg.MaxKeys)
+}
+
+// fitsLocked reports whether creating whichever of keys don't exist yet
+// stays within -max-keys.
+func (kvs *KeyValueStore) fitsLocked(keys []string) bool {
+	added := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, exists := kvs.store[key]; !exists {
+			added[key] = true
+		}
+	}
+	return len(added) == 0 || len(kvs.store)+len(added) <= kvs.cfg.MaxKeys
+}
+
+// makeRoomLocked evicts least recently used keys until one more key fits
+// under -max-keys. Callers must hold kvs.mu for writing.
+func (kvs *KeyValueStore) makeRoomLocked() {
+	for len(kvs.store) >= kvs.cfg.MaxKeys {
+		victim, ok := kvs.lru.oldest()
+		if !ok {
+			return
+		}
+		if kvs.deleteLocked(victim) {
+			kvs.ops.evictions.Add(1)
+		} else {
+			// Not in the store any more; just forget it.
+			kvs.lru.remove(victim)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestMaxKeysRejectMode(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxKeys = 2
+	kvs := newTestStore(t, cfg)
+	for _, key := range []string{"a", "b"} {
+		if err := kvs.Set(key, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := kvs.Set("c", "1"); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("creating a key at capacity: %v, want ErrStoreFull", err)
+	}
+	rec := serve(kvs.handleSet, http.MethodPost, "/set", `{"key":"c","value":"1"}`)
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("/set of a new key at capacity: status %d, want 507: %s", rec.Code, rec.Body)
+	}
+
+	if err := kvs.Set("a", "2"); err != nil {
+		t.Errorf("updating a key at capacity: %v", err)
+	}
+	rec = serve(kvs.handleSet, http.MethodPost, "/set", `{"key":"b","value":"2"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("/set of an existing key at capacity: status %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	for key, want := range map[string]string{"a": "2", "b": "2"} {
+		if got, _ := kvs.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := kvs.Get("c"); ok || kvs.Count() != 2 {
+		t.Errorf("store holds %d keys (c found: %v), want only a and b", kvs.Count(), ok)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Merge strategies decide what happens when an incoming key already exists.
+const (
+	// MergeKeepExisting leaves existing keys alone and only adds new ones.
+	MergeKeepExisting = "keep_existing"
+	// MergeOverwrite replaces existing keys with the incoming values.
+	MergeOverwrite = "overwrite"
+	// MergeNewerWins replaces an existing key only if it was last modified
+	// before the incoming data's as-of time.
+	MergeNewerWins = "newer_wins"
+)
+
+var errUnknownMergeStrategy = errors.New("unknown merge strategy")
+
+// MergeReport counts how each incoming key was resolved.
+type MergeReport struct {
+	Added       int `json:"added"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+}
+
+// MergeRequest is the body of /merge. AsOf is required for newer_wins and
+// is recorded as the modification time of every key the merge writes, so
+// replaying the same merge is a no-op.
+type MergeRequest struct {
+	Data     map[string]string `json:"data"`
+	Strategy string            `json:"strategy"`
+	AsOf     time.Time         `json:"as_of"`
+}
+
+// Merge folds data into the store, resolving keys that already exist
+// according to strategy. It is all-or-nothing: if any key is rejected or
+// the new keys would exceed a quota, nothing is written.
+func (kvs *KeyValueStore) Merge(data map[string]string, strategy string, asOf time.Time) (MergeReport, error) {
+	var report MergeReport
+	switch strategy {
+	case MergeKeepExisting, MergeOverwrite, MergeNewerWins:
+	default:
+		return report, errUnknownMergeStrategy
+	}
+
+	incoming := make(map[string]string, len(data))
+	for key, value := range data {
+		key = kvs.normalizeKey(key)
+		if err := kvs.validateKey(key); err != nil {
+			return report, err
+		}
+		if err := kvs.validateValue(value); err != nil {
+			return report, err
+		}
+		incoming[key] = value
+	}
+
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	now := time.Now()
+	writes := make(map[string]string, len(incoming))
+	var created []string
+	for key, value := range incoming {
+		current, exists := kvs.lookupLocked(key, now)
+		switch {
+		case !exists:
+			report.Added++
+		case strategy == MergeKeepExisting,
+			strategy == MergeNewerWins && !kvs.modified[key].Before(asOf),
+			current == value:
+			report.Skipped++
+			continue
+		default:
+			report.Overwritten++
+		}
+		writes[key] = value
+		if _, stored := kvs.store[key]; !stored {
+			created = append(created, key)
+		}
+	}
+	if err := kvs.checkQuotaLocked(created...); err != nil {
+		return MergeReport{}, err
+	}
+	if err := kvs.checkCapacityLocked(created...); err != nil {
+		return MergeReport{}, err
+	}
+
+	modified := asOf
+	if modified.IsZero() {
+		modified = now
+	}
+	for key, value := range writes {
+		if err := kvs.setAtLocked(key, value, modified); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (kvs *KeyValueStore) handleMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req MergeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+	if req.Strategy == MergeNewerWins && req.AsOf.IsZero() {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "as_of is required for newer_wins"}, http.StatusBadRequest)
+		return
+	}
+	for key := range req.Data {
+		if kvs.normalizeKey(key) == "" {
+			sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := kvs.Merge(req.Data, req.Strategy, req.AsOf)
+	if errors.Is(err, errUnknownMergeStrategy) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "strategy must be keep_existing, overwrite or newer_wins"}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+
+	// Like /replace, a merge is usually a deliberate data load.
+	if err := kvs.requestSave(); err != nil {
+		log.Printf("Error saving to disk after merge: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+
+	sendJSONResponse(w, report, http.StatusOK)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// The metadata file holds per-key metadata (expirations, content types and
+// modification times) next to the data file, so the data file itself stays
+// a key/value JSON object. metaSuffix replaces ".json" in the name of any
+// snapshot, whether the data file, the mirror or a backup, to name the
+// metadata file that goes with it.
+const metaSuffix = ".meta.json"
+
+// metaPathFor returns the path of the metadata file for the snapshot at
+// dataPath.
+func metaPathFor(dataPath string) string {
+	return strings.TrimSuffix(dataPath, ".json") + metaSuffix
+}
+
+// keyMeta is the persisted metadata for one key.
+type keyMeta struct {
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	ModifiedAt  *time.Time `json:"modified_at,omitempty"`
+}
+
+// snapshotLocked returns the contents of the data and metadata files for the
+// current store, as prepared by snapshotData. Callers must hold kvs.mu.
+func (kvs *KeyValueStore) snapshotLocked() (any, map[string]keyMeta) {
+	return snapshotData(kvs.store), kvs.snapshotMetaLocked()
+}
+
+// snapshotMetaLocked collects the metadata for every key that has any.
+// Callers must hold kvs.mu.
+func (kvs *KeyValueStore) snapshotMetaLocked() map[string]keyMeta {
+	meta := make(map[string]keyMeta)
+	for key, item := range kvs.expiries.byKey {
+		at := item.at
+		meta[key] = keyMeta{ExpiresAt: &at}
+	}
+	for key, contentType := range kvs.contentTypes {
+		m := meta[key]
+		m.ContentType = contentType
+		meta[key] = m
+	}
+	for key, at := range kvs.modified {
+		m := meta[key]
+		at := at
+		m.ModifiedAt = &at
+		meta[key] = m
+	}
+	return meta
+}
+
+// loadMeta reads the metadata file at path and applies it to keys already
+// loaded from the snapshot it belongs to. Metadata for keys that no longer
+// exist is dropped. The two files are renamed separately, so after a crash
+// the metadata may be one save older than the data; with -wal the log still
+// holds every write since the previous snapshot and replaying it corrects
+// the values.
+//
+// Unusable metadata doesn't stop the store from starting: the keys are kept
+// without their expirations, content types and encodings, the file is moved
+// aside for inspection, and the store is marked dirty so the next save
+// writes fresh metadata.
+func (kvs *KeyValueStore) loadMeta(path string) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	var meta map[string]keyMeta
+	if err == nil {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return
+		}
+		err = json.Unmarshal(data, &meta)
+	}
+	if err != nil {
+		corrupt := path + ".corrupt-" + time.Now().UTC().Format(backupTimeFormat)
+		if err := os.Rename(path, corrupt); err != nil {
+			log.Printf("Could not move %s aside: %v", path, err)
+			corrupt = "(left in place)"
+		}
+		log.Printf("WARNING: %s is unusable (%v); moved it to %s and loaded every key without its expiration or content type", path, err, corrupt)
+		kvs.dirty = true
+		return
+	}
+
+	for key, m := range meta {
+		if _, ok := kvs.store[key]; !ok {
+			continue
+		}
+		if m.ExpiresAt != nil {
+			kvs.expiries.set(key, *m.ExpiresAt)
+		}
+		if m.ContentType != "" {
+			kvs.contentTypes[key] = m.ContentType
+		}
+		if m.ModifiedAt != nil {
+			kvs.modified[key] = *m.ModifiedAt
+		}
+	}
+}
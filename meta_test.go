@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setMetaFixture writes a key with a TTL and content type and a binary
+// value, whose meta entry carries its encoding.
+func setMetaFixture(t *testing.T, kvs *KeyValueStore) (binary string) {
+	t.Helper()
+	if _, _, err := kvs.Swap("typed", `{"a":1}`, "application/json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.Set("expiring", "v"); err != nil {
+		t.Fatal(err)
+	}
+	kvs.mu.Lock()
+	kvs.expireLocked("expiring", time.Hour, time.Now())
+	kvs.mu.Unlock()
+	return setHighBits(t, kvs, "bitmap")
+}
+
+func checkMetaFixture(t *testing.T, kvs *KeyValueStore, binary, from string) {
+	t.Helper()
+	if _, contentType, ok := kvs.GetRaw("typed"); !ok || contentType != "application/json" {
+		t.Errorf("from %s: typed has content type %q (found %v), want application/json", from, contentType, ok)
+	}
+	if ttl, ok := kvs.TTL("expiring"); !ok || ttl <= 0 {
+		t.Errorf("from %s: expiring has TTL %v (found %v), want one", from, ttl, ok)
+	}
+	if got, _ := kvs.Get("bitmap"); got != binary {
+		t.Errorf("from %s: bitmap = %q, want %q", from, got, binary)
+	}
+}
+
+func TestCorruptMetaDoesNotFailStartup(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	setMetaFixture(t, kvs)
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kvs.metaPath(), []byte(`{"typed":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs = reopen(t, kvs)
+	if got, ok := kvs.Get("typed"); !ok || got != `{"a":1}` {
+		t.Errorf("typed = %q (found %v) after loading with corrupt metadata", got, ok)
+	}
+	if ttl, _ := kvs.TTL("expiring"); ttl >= 0 {
+		t.Errorf("expiring kept TTL %v without metadata", ttl)
+	}
+	corrupt, _ := filepath.Glob(kvs.metaPath() + ".corrupt-*")
+	if len(corrupt) != 1 {
+		t.Errorf("found %v, want the corrupt metadata moved aside", corrupt)
+	}
+
+	// The store is dirty, so the next save replaces the bad metadata.
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	kvs.loadMeta(kvs.metaPath())
+	if kvs.dirty {
+		t.Error("the rewritten metadata doesn't load cleanly")
+	}
+}
+
+func TestMirrorKeepsMeta(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MirrorFile = filepath.Join(t.TempDir(), "mirror.json")
+	kvs := newTestStore(t, cfg)
+	binary := setMetaFixture(t, kvs)
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(metaPathFor(cfg.MirrorFile)); err != nil {
+		t.Fatalf("mirror metadata: %v", err)
+	}
+
+	// Lose the primary data file and its metadata together, as when the
+	// disk holding -data-dir is replaced.
+	for _, path := range []string{kvs.dataPath(), kvs.metaPath()} {
+		if err := os.WriteFile(path, []byte("{corrupt"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kvs = reopen(t, kvs)
+	checkMetaFixture(t, kvs, binary, "the mirror")
+}
+
+func TestBackupKeepsMeta(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	binary := setMetaFixture(t, kvs)
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	path, err := kvs.writeBackup(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(metaPathFor(path)); err != nil {
+		t.Fatalf("backup metadata: %v", err)
+	}
+	if names, err := kvs.listBackups(); err != nil || len(names) != 1 {
+		t.Fatalf("listBackups = %v, %v, want just the backup", names, err)
+	}
+
+	if err := os.WriteFile(kvs.dataPath(), []byte("{corrupt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kvs = reopen(t, kvs)
+	checkMetaFixture(t, kvs, binary, "the backup")
+
+	kvs.cfg.BackupRetainCount = 1
+	if _, err := kvs.writeBackup(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.pruneBackups(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(metaPathFor(path)); !os.IsNotExist(err) {
+		t.Errorf("pruned backup left its metadata behind: %v", err)
+	}
+}
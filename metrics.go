@@ -0,0 +1,31 @@
+package main
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// opCounters counts store operations since startup.
+type opCounters struct {
+	sets      atomic.Uint64
+	gets      atomic.Uint64
+	deletes   atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// publishExpvar registers the store's counters with expvar under
+// "kvstore". It must be called at most once per process.
+func (kvs *KeyValueStore) publishExpvar() {
+	expvar.Publish("kvstore", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"sets":            kvs.ops.sets.Load(),
+			"gets":            kvs.ops.gets.Load(),
+			"deletes":         kvs.ops.deletes.Load(),
+			"evictions":       kvs.ops.evictions.Load(),
+			"failed_saves":    kvs.saveHealth.failures.Load(),
+			"disk_full":       kvs.Health().DiskFull,
+			"changes_dropped": kvs.changesDropped(),
+			"keys":            kvs.Count(),
+		}
+	}))
+}
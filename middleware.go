@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusRecorder wraps a ResponseWriter to remember the status code the
+// handler sent, for use by middleware after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// requestKey returns the key a request operates on, from either the ?key=
+// parameter or a {key} path wildcard. Path values are only set once the mux
+// has routed the request, so call it after the handler returns.
+func requestKey(r *http.Request) string {
+	if key := r.URL.Query().Get("key"); key != "" {
+		return key
+	}
+	return r.PathValue("key")
+}
+
+// slowRequestMiddleware logs a warning for every request that takes longer
+// than threshold, so pathological requests show up without logging all of
+// them.
+func slowRequestMiddleware(next http.Handler, threshold time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		if elapsed := time.Since(start); elapsed > threshold {
+			log.Printf("WARN slow request: %s %s key=%q status=%d took %v", r.Method, r.URL.Path, requestKey(r), rec.status, elapsed)
+		}
+	})
+}
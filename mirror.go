@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"time"
+)
+
+// loadMirror replaces the store with the -mirror-file snapshot and its
+// metadata after the data file failed to load with loadErr, or was missing or
+// empty if loadErr is nil. It reports false, leaving the store untouched, if
+// there is no mirror or it can't be decoded either. On success the store is
+// marked dirty so the next save writes the data file back.
+func (kvs *KeyValueStore) loadMirror(loadErr error) bool {
+	path := kvs.cfg.MirrorFile
+	if path == "" {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Mirror %s is unreadable: %v", path, err)
+		}
+		return false
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return false
+	}
+	store := make(map[string]string, kvs.cfg.InitialCapacity)
+	if err := decodeSnapshot(data, store); err != nil {
+		log.Printf("Mirror %s is corrupt: %v", path, err)
+		return false
+	}
+
+	dataPath := kvs.dataPath()
+	if loadErr == nil {
+		log.Printf("%s is missing or empty; loaded %d keys from mirror %s", dataPath, len(store), path)
+	} else {
+		// Keep the bad primary for inspection, as recoverFromBackup does.
+		// If it can't even be renamed the next save replaces it anyway.
+		corrupt := dataPath + ".corrupt-" + time.Now().UTC().Format(backupTimeFormat)
+		if err := os.Rename(dataPath, corrupt); err != nil {
+			log.Printf("Could not move %s aside: %v", dataPath, err)
+			corrupt = "(left in place)"
+		}
+		log.Printf("%s is unusable (%v); moved it to %s and loaded %d keys from mirror %s", dataPath, loadErr, corrupt, len(store), path)
+	}
+	kvs.store = store
+	kvs.dirty = true
+	kvs.loadMeta(metaPathFor(path))
+	return true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// MultiCASEntry swaps Key from Old to New. As with a cas in /txn, the key
+// must exist and hold exactly Old.
+type MultiCASEntry struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type MultiCASResponse struct {
+	Committed bool     `json:"committed"`
+	Failed    []string `json:"failed"`
+}
+
+// MultiCAS applies every entry if all of their expected values match, and
+// none of them otherwise, returning the keys whose values didn't match. It
+// is a transaction of cas operations only, so it shares Txn's validation,
+// quota and capacity checks. A key named twice is rejected as in other
+// batch writes.
+func (kvs *KeyValueStore) MultiCAS(entries []MultiCASEntry) (failed []string, committed bool, err error) {
+	seen := make(map[string]bool, len(entries))
+	ops := make([]TxnOp, len(entries))
+	for i, e := range entries {
+		if err := kvs.checkDuplicateKeys(seen, kvs.normalizeKey(e.Key)); err != nil {
+			return nil, false, err
+		}
+		ops[i] = TxnOp{Op: TxnCAS, Key: e.Key, Old: e.Old, Value: e.New}
+	}
+
+	results, committed, err := kvs.Txn(ops)
+	if err != nil {
+		return nil, false, err
+	}
+	failed = []string{}
+	for _, result := range results {
+		if !result.OK {
+			failed = append(failed, result.Key)
+		}
+	}
+	return failed, committed, nil
+}
+
+func (kvs *KeyValueStore) handleMultiCAS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var entries []MultiCASEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	for _, e := range entries {
+		if kvs.normalizeKey(e.Key) == "" {
+			sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	end := startSpan(r.Context(), "store.MultiCAS", "")
+	failed, committed, err := kvs.MultiCAS(entries)
+	end()
+	if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusConflict
+	} else if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, MultiCASResponse{Committed: committed, Failed: failed}, status)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeText = "text/plain"
+)
+
+// negotiateContentType picks between JSON and plain text based on the
+// request's Accept header. JSON wins ties and is the default when the
+// header is missing or names neither type.
+func negotiateContentType(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return contentTypeJSON
+	}
+
+	jsonQ, textQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		switch mediaType {
+		case contentTypeJSON:
+			jsonQ = max(jsonQ, q)
+		case contentTypeText:
+			textQ = max(textQ, q)
+		}
+	}
+
+	if textQ > 0 && textQ > jsonQ {
+		return contentTypeText
+	}
+	return contentTypeJSON
+}
+
+func sendTextResponse(w http.ResponseWriter, text string, statusCode int) {
+	w.Header().Set("Content-Type", contentTypeText+"; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(text))
+}
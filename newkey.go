@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// NewRequest is the body of /new. The generated key is Prefix followed by a
+// random UUID.
+type NewRequest struct {
+	Value       string `json:"value"`
+	Prefix      string `json:"prefix,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+type NewResponse struct {
+	Key      string `json:"key"`
+	Status   string `json:"status"`
+	Checksum string `json:"checksum"`
+}
+
+// newUUID returns a random (version 4) UUID in its canonical form.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Create stores value under a newly generated key starting with prefix and
+// returns the key. Random UUIDs rather than a counter keep keys unique
+// across restarts without persisting any state, and the key is checked
+// under the write lock so even a collision can't overwrite a value.
+func (kvs *KeyValueStore) Create(prefix, value, contentType string) (string, error) {
+	if err := validateContentType(contentType); err != nil {
+		return "", err
+	}
+
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	key := kvs.normalizeKey(prefix + newUUID())
+	for {
+		if _, exists := kvs.store[key]; !exists {
+			break
+		}
+		key = kvs.normalizeKey(prefix + newUUID())
+	}
+	if err := kvs.setLocked(key, value); err != nil {
+		return "", err
+	}
+	kvs.setContentTypeLocked(key, contentType)
+	return key, nil
+}
+
+func (kvs *KeyValueStore) handleNew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if limit := kvs.maxSetBodyBytes(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeValueTooLarge, Error: "Request body too large"}, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req NewRequest
+	if err := decodeStrictJSON(body, &req); errors.Is(err, errDuplicateJSONKey) || errors.Is(err, errTrailingJSON) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: err.Error()}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	key, err := kvs.Create(req.Prefix, req.Value, req.ContentType)
+	if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+
+	w.Header().Set("ETag", valueETag(req.Value))
+	sendJSONResponse(w, NewResponse{Key: key, Status: "OK", Checksum: valueChecksum(req.Value)}, http.StatusCreated)
+}
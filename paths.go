@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dataPath, metaPath and lockPath place -data-file and the files beside it
+// in -data-dir.
+// walPath places the write-ahead log in -wal-dir, which defaults to the
+// data directory, so the log can live on faster storage than snapshots.
+func (kvs *KeyValueStore) dataPath() string {
+	return filepath.Join(kvs.cfg.DataDir, kvs.cfg.DataFile)
+}
+
+func (kvs *KeyValueStore) metaPath() string {
+	return metaPathFor(kvs.dataPath())
+}
+
+func (kvs *KeyValueStore) lockPath() string {
+	return kvs.dataPath() + lockSuffix
+}
+
+func (kvs *KeyValueStore) walPath() string {
+	dir := kvs.cfg.WALDir
+	if dir == "" {
+		dir = kvs.cfg.DataDir
+	}
+	return filepath.Join(dir, walFile)
+}
+
+// makeDataDirs creates the data and WAL directories if they don't exist.
+func (kvs *KeyValueStore) makeDataDirs() error {
+	if err := os.MkdirAll(filepath.Dir(kvs.dataPath()), 0o755); err != nil {
+		return err
+	}
+	if kvs.cfg.WAL {
+		return os.MkdirAll(filepath.Dir(kvs.walPath()), 0o755)
+	}
+	return nil
+}
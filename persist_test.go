@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadEmptyDataFile(t *testing.T) {
+	for _, contents := range []string{"", "  \n\t\n"} {
+		cfg := testConfig(t)
+		if err := os.WriteFile(filepath.Join(cfg.DataDir, cfg.DataFile), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		kvs := newTestStore(t, cfg)
+		if n := kvs.Count(); n != 0 {
+			t.Errorf("%q: loaded %d keys, want an empty store", contents, n)
+		}
+
+		// The store must still be writable and save over the empty file.
+		if err := kvs.Set("k", "v"); err != nil {
+			t.Fatal(err)
+		}
+		if err := kvs.saveToDisk(); err != nil {
+			t.Fatalf("%q: saveToDisk: %v", contents, err)
+		}
+		kvs = reopen(t, kvs)
+		if got, _ := kvs.Get("k"); got != "v" {
+			t.Errorf("%q: after a save and reload k = %q, want v", contents, got)
+		}
+	}
+}
+
+func TestSnapshotIsDeterministic(t *testing.T) {
+	keys := []string{"b", "a", "c/1", "c", "A", "ä", "10", "9"}
+	save := func(order []string) []byte {
+		t.Helper()
+		kvs := newTestStore(t, testConfig(t))
+		for _, key := range order {
+			if err := kvs.Set(key, "value of "+key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := kvs.saveToDisk(); err != nil {
+			t.Fatal(err)
+		}
+		first, err := os.ReadFile(kvs.dataPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Saving unchanged data again must produce the same bytes.
+		kvs.mu.Lock()
+		kvs.dirty = true
+		kvs.mu.Unlock()
+		if err := kvs.saveToDisk(); err != nil {
+			t.Fatal(err)
+		}
+		second, err := os.ReadFile(kvs.dataPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(first) != string(second) {
+			t.Errorf("resaving the same data changed the snapshot:\n%s\n%s", first, second)
+		}
+		return first
+	}
+
+	forward := save(keys)
+	reversed := make([]string, len(keys))
+	for i, key := range keys {
+		reversed[len(keys)-1-i] = key
+	}
+	if backward := save(reversed); string(forward) != string(backward) {
+		t.Errorf("insertion order changed the snapshot:\n%s\n%s", forward, backward)
+	}
+
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	last := -1
+	for _, key := range sorted {
+		i := strings.Index(string(forward), `"`+key+`":`)
+		if i <= last {
+			t.Fatalf("key %q is out of order in %s", key, forward)
+		}
+		last = i
+	}
+}
+
+func TestCustomDataFile(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DataFile = "custom.json"
+	kvs := newTestStore(t, cfg)
+	if err := kvs.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"custom.json", "custom.meta.json", "custom.json.lock"} {
+		if _, err := os.Stat(filepath.Join(cfg.DataDir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cfg.DataDir, defaultDataFile)); !os.IsNotExist(err) {
+		t.Errorf("%s was written too: %v", defaultDataFile, err)
+	}
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("k"); got != "v" {
+		t.Errorf("k = %q after reload, want v", got)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// startPprofServer serves the net/http/pprof handlers on addr. It uses its
+// own mux so the profiling endpoints are never reachable on the data port.
+func startPprofServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	fmt.Printf("pprof server starting on http://%s/debug/pprof/\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("pprof server error: %v", err)
+	}
+}
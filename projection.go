@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	errValueNotJSON = errors.New("value is not valid JSON")
+	errPathNotFound = errors.New("path not found in value")
+)
+
+// projectJSON returns the JSON encoding of the part of value addressed by a
+// dot-separated path such as "user.emails.0". Object fields are matched by
+// name and array elements by index.
+func projectJSON(value, path string) (string, error) {
+	doc, err := decodeJSONValue(value)
+	if err != nil {
+		return "", errValueNotJSON
+	}
+
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return "", fmt.Errorf("%w: no field %q", errPathNotFound, segment)
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("%w: no index %q", errPathNotFound, segment)
+			}
+			current = node[i]
+		default:
+			return "", fmt.Errorf("%w: %q is not an object or array", errPathNotFound, segment)
+		}
+	}
+	return encodeJSONValue(current)
+}
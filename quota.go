@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrPrefixQuotaExceeded is returned when creating a key would push a
+// prefix over its configured key limit.
+var ErrPrefixQuotaExceeded = errors.New("prefix quota exceeded")
+
+// prefixQuotaFlag collects repeated -prefix-quota prefix=limit flags.
+type prefixQuotaFlag map[string]int
+
+func (f prefixQuotaFlag) String() string {
+	parts := make([]string, 0, len(f))
+	for prefix, limit := range f {
+		parts = append(parts, prefix+"="+strconv.Itoa(limit))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (f prefixQuotaFlag) Set(s string) error {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected prefix=limit, got %q", s)
+	}
+	limit, err := strconv.Atoi(s[i+1:])
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid limit in %q", s)
+	}
+	f[s[:i]] = limit
+	return nil
+}
+
+// prefixQuotas tracks how many keys exist under each limited prefix. Counts
+// are maintained incrementally by setLocked and deleteLocked, and are
+// guarded by kvs.mu.
+type prefixQuotas struct {
+	limits map[string]int
+	counts map[string]int
+}
+
+func newPrefixQuotas(limits map[string]int) *prefixQuotas {
+	return &prefixQuotas{
+		limits: limits,
+		counts: make(map[string]int, len(limits)),
+	}
+}
+
+// add adjusts the count of every limited prefix that key falls under.
+func (q *prefixQuotas) add(key string, delta int) {
+	for prefix := range q.limits {
+		if strings.HasPrefix(key, prefix) {
+			q.counts[prefix] += delta
+		}
+	}
+}
+
+// recount rebuilds all counts from store.
+func (q *prefixQuotas) recount(store map[string]string) {
+	q.counts = make(map[string]int, len(q.limits))
+	for key := range store {
+		q.add(key, 1)
+	}
+}
+
+// checkQuotaLocked reports whether the given keys can be created without
+// exceeding any prefix quota. Keys that already exist do not count against
+// a quota. Callers must hold kvs.mu.
+func (kvs *KeyValueStore) checkQuotaLocked(keys ...string) error {
+	if kvs.quotas == nil {
+		return nil
+	}
+
+	added := make(map[string]int)
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, exists := kvs.store[key]; exists || seen[key] {
+			continue
+		}
+		seen[key] = true
+		for prefix, limit := range kvs.quotas.limits {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			added[prefix]++
+			if kvs.quotas.counts[prefix]+added[prefix] > limit {
+				return fmt.Errorf("%w: %q allows %d keys", ErrPrefixQuotaExceeded, prefix, limit)
+			}
+		}
+	}
+	return nil
+}
+
+// check reports whether a store holding exactly keys stays within every
+// prefix quota, for replacing or renaming the store's contents rather than
+// adding to them.
+func (q *prefixQuotas) check(keys iter.Seq[string]) error {
+	counts := make(map[string]int, len(q.limits))
+	for key := range keys {
+		for prefix, limit := range q.limits {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			counts[prefix]++
+			if counts[prefix] > limit {
+				return fmt.Errorf("%w: %q allows %d keys", ErrPrefixQuotaExceeded, prefix, limit)
+			}
+		}
+	}
+	return nil
+}
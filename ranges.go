@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errNegativeOffset = errors.New("offset must not be negative")
+
+type SetRangeRequest struct {
+	Key    string `json:"key"`
+	Offset int    `json:"offset"`
+	Value  string `json:"value"`
+}
+
+type SetRangeResponse struct {
+	Status string `json:"status"`
+	Length int    `json:"length"`
+}
+
+// GetRangeResponse carries the range like GetResponse: base64-encoded, with
+// Encoding set, if it isn't valid UTF-8.
+type GetRangeResponse struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type StrLenResponse struct {
+	Key    string `json:"key"`
+	Length int    `json:"length"`
+}
+
+// SetRange overwrites the bytes of key's value starting at offset with data
+// and returns the new length, like Redis SETRANGE. A value shorter than
+// offset is padded with zero bytes first, and a missing key is treated as
+// an empty value. Writing no data leaves the store untouched. The key keeps
+// its TTL and content type.
+func (kvs *KeyValueStore) SetRange(key string, offset int, data string) (int, error) {
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	key = kvs.normalizeKey(key)
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	current, _ := kvs.lookupLocked(key, time.Now())
+	if data == "" {
+		return len(current), nil
+	}
+	// Reject oversized results before padding so a huge offset cannot
+	// allocate a value under the lock.
+	if err := kvs.checkExtent(offset, len(data)); err != nil {
+		return 0, err
+	}
+
+	var b strings.Builder
+	b.Grow(max(len(current), offset+len(data)))
+	if offset > len(current) {
+		b.WriteString(current)
+		b.WriteString(strings.Repeat("\x00", offset-len(current)))
+	} else {
+		b.WriteString(current[:offset])
+	}
+	b.WriteString(data)
+	if end := offset + len(data); end < len(current) {
+		b.WriteString(current[end:])
+	}
+
+	updated := b.String()
+	if err := kvs.updateLocked(key, updated); err != nil {
+		return 0, err
+	}
+	return len(updated), nil
+}
+
+// GetRange returns the bytes of key's value between start and end inclusive,
+// like Redis GETRANGE. Negative indices count back from the end, so -1 is
+// the last byte. Out-of-range indices are clamped, and a missing key or an
+// empty range yields "".
+func (kvs *KeyValueStore) GetRange(key string, start, end int) string {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	value, ok := kvs.lookupLocked(key, time.Now())
+	kvs.ops.gets.Add(1)
+	kvs.recordAccess(key, false)
+	if !ok {
+		return ""
+	}
+	kvs.touchKey(key)
+
+	start, end = clampRange(len(value), start, end)
+	return value[start:end]
+}
+
+// clampRange turns Redis-style inclusive indices into a half-open range
+// within a value of n bytes. Negative indices count back from the end and
+// out-of-range ones are clamped, so the result is always safe to slice with
+// and empty if the range is.
+func clampRange(n, start, end int) (int, int) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = n + end
+	}
+	end = min(end, n-1)
+	if start > end {
+		return 0, 0
+	}
+	return start, end + 1
+}
+
+// StrLen returns the length in bytes of key's value, or 0 if the key is
+// missing, without copying the value out.
+func (kvs *KeyValueStore) StrLen(key string) int {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	value, _ := kvs.lookupLocked(key, time.Now())
+	return len(value)
+}
+
+func (kvs *KeyValueStore) handleSetRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req SetRangeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if kvs.normalizeKey(req.Key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	length, err := kvs.SetRange(req.Key, req.Offset, req.Value)
+	if errors.Is(err, errNegativeOffset) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid offset"}, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, ErrValueTooLarge) {
+		// The request itself is small; it is the offset that is out of
+		// range, so this is a plain bad request rather than a 413.
+		sendJSONResponse(w, ErrorResponse{Code: CodeValueTooLarge, Error: err.Error()}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, SetRangeResponse{Status: "OK", Length: length}, http.StatusOK)
+}
+
+func (kvs *KeyValueStore) handleGetRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	start, end, ok := parseRangeParams(w, r)
+	if !ok {
+		return
+	}
+
+	value, encoding := encodeValue(kvs.GetRange(key, start, end))
+	sendJSONResponse(w, GetRangeResponse{Key: kvs.normalizeKey(key), Value: value, Encoding: encoding}, http.StatusOK)
+}
+
+// parseRangeParams reads the optional start and end query parameters,
+// sending an error response and returning false if either is invalid.
+// Without bounds the range is the whole value, as with start=0&end=-1.
+func parseRangeParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	start, end := 0, -1
+	if s := r.URL.Query().Get("start"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid start"}, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		start = n
+	}
+	if s := r.URL.Query().Get("end"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid end"}, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		end = n
+	}
+	return start, end, true
+}
+
+func (kvs *KeyValueStore) handleStrLen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	sendJSONResponse(w, StrLenResponse{Key: kvs.normalizeKey(key), Length: kvs.StrLen(key)}, http.StatusOK)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetRangeOnExpiredKeyStartsFresh(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("k", "old value"); err != nil {
+		t.Fatal(err)
+	}
+	kvs.mu.Lock()
+	kvs.expiries.set("k", time.Now().Add(-time.Second))
+	kvs.setContentTypeLocked("k", "text/plain")
+	kvs.mu.Unlock()
+
+	n, err := kvs.SetRange("k", 2, "xy")
+	if err != nil {
+		t.Fatalf("SetRange: %v", err)
+	}
+	if want := "\x00\x00xy"; n != len(want) {
+		t.Errorf("SetRange length = %d, want %d", n, len(want))
+	}
+	ttl, ok := kvs.TTL("k")
+	if !ok || ttl >= 0 {
+		t.Errorf("TTL = %v, %v; want a live key without expiry", ttl, ok)
+	}
+	kvs.mu.RLock()
+	contentType := kvs.contentTypes["k"]
+	kvs.mu.RUnlock()
+	if contentType != "" {
+		t.Errorf("content type %q survived expiry", contentType)
+	}
+}
+
+func TestSetRangeKeepsLiveTTL(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("k", "value"); err != nil {
+		t.Fatal(err)
+	}
+	kvs.mu.Lock()
+	kvs.expireLocked("k", time.Hour, time.Now())
+	kvs.mu.Unlock()
+
+	if _, err := kvs.SetRange("k", 0, "V"); err != nil {
+		t.Fatalf("SetRange: %v", err)
+	}
+	if ttl, ok := kvs.TTL("k"); !ok || ttl <= 0 {
+		t.Errorf("TTL = %v, %v; want the hour TTL kept", ttl, ok)
+	}
+}
+
+// TestSetRangeSplittingRune overwrites half of a multibyte character. The
+// resulting bytes aren't valid UTF-8 and must come back unchanged after a
+// save and reload rather than as U+FFFD.
+func TestSetRangeSplittingRune(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("k", "añb"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kvs.SetRange("k", 2, "!"); err != nil {
+		t.Fatalf("SetRange: %v", err)
+	}
+	want := "a\xc3!b"
+	if got, _ := kvs.Get("k"); got != want {
+		t.Fatalf("Get = %q, want %q", got, want)
+	}
+	if got := kvs.GetRange("k", 1, 1); got != "\xc3" {
+		t.Errorf("GetRange(1, 1) = %q, want %q", got, "\xc3")
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatalf("saveToDisk: %v", err)
+	}
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("k"); got != want {
+		t.Errorf("after reload Get = %q, want %q", got, want)
+	}
+}
+
+func TestSetRangeSplittingRuneWithRequireUTF8(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RequireUTF8 = true
+	kvs := newTestStore(t, cfg)
+	if err := kvs.Set("k", "añb"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kvs.SetRange("k", 2, "!"); err == nil {
+		t.Error("SetRange split a character despite -require-utf8")
+	}
+}
+
+func TestSetRangeOffsetLimit(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	for _, offset := range []int{maxValueExtent, maxValueExtent - 1, math.MaxInt, math.MaxInt - 1} {
+		if _, err := kvs.SetRange("k", offset, "xy"); !errors.Is(err, ErrValueTooLarge) {
+			t.Errorf("SetRange at offset %d: %v, want ErrValueTooLarge", offset, err)
+		}
+	}
+	if _, ok := kvs.Get("k"); ok {
+		t.Error("a rejected SetRange created the key")
+	}
+
+	body := `{"key":"k","offset":` + strconv.Itoa(math.MaxInt) + `,"value":"x"}`
+	rec := serve(kvs.handleSetRange, http.MethodPost, "/setrange", body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeValueTooLarge) {
+		t.Errorf("/setrange at MaxInt: status %d: %s, want 400 %s", rec.Code, rec.Body, CodeValueTooLarge)
+	}
+
+	// -max-value-bytes tightens the cap when it is set.
+	cfg := testConfig(t)
+	cfg.MaxValueBytes = 16
+	kvs = newTestStore(t, cfg)
+	if _, err := kvs.SetRange("k", 14, "xy"); err != nil {
+		t.Errorf("SetRange ending at the limit: %v", err)
+	}
+	if _, err := kvs.SetRange("k", 15, "xy"); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("SetRange past the limit: %v, want ErrValueTooLarge", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// recoverFromBackup is called when the data file can't be decoded. It loads the
+// newest backup that decodes cleanly along with that backup's metadata,
+// moves the corrupt file aside so it can be inspected (and isn't overwritten
+// by the next save), and marks the store dirty so the recovered data is
+// written back to the data file.
+func (kvs *KeyValueStore) recoverFromBackup(loadErr error) error {
+	dataPath := kvs.dataPath()
+	names, err := kvs.listBackups()
+	if err != nil {
+		return fmt.Errorf("%s is corrupt (%v) and backups could not be listed: %w", dataPath, loadErr, err)
+	}
+
+	for i := len(names) - 1; i >= 0; i-- {
+		path := filepath.Join(kvs.cfg.BackupDir, names[i])
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Skipping backup %s: %v", path, err)
+			continue
+		}
+		store := make(map[string]string, kvs.cfg.InitialCapacity)
+		if err := decodeSnapshot(data, store); err != nil {
+			log.Printf("Skipping corrupt backup %s: %v", path, err)
+			continue
+		}
+
+		corrupt := dataPath + ".corrupt-" + time.Now().UTC().Format(backupTimeFormat)
+		if err := os.Rename(dataPath, corrupt); err != nil {
+			return fmt.Errorf("moving corrupt %s aside: %w", dataPath, err)
+		}
+		kvs.store = store
+		kvs.dirty = true
+		kvs.loadMeta(metaPathFor(path))
+		log.Printf("%s is corrupt (%v); moved it to %s and recovered %d keys from backup %s", dataPath, loadErr, corrupt, len(store), path)
+		return nil
+	}
+	return fmt.Errorf("%s is corrupt and no usable backup was found in %s: %w", dataPath, kvs.cfg.BackupDir, loadErr)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"maps"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rekey modes.
+const (
+	RekeyAddPrefix   = "add_prefix"
+	RekeyStripPrefix = "strip_prefix"
+	RekeyRegexp      = "regexp"
+)
+
+var errInvalidRekey = errors.New("invalid rekey request")
+
+type RekeyRequest struct {
+	Mode        string `json:"mode"`
+	Prefix      string `json:"prefix,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	// DryRun reports what would change without changing anything.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// RekeyCollision is a target key that more than one key would end up as,
+// including a key that already exists and isn't being renamed itself.
+type RekeyCollision struct {
+	Key     string   `json:"key"`
+	Sources []string `json:"sources"`
+}
+
+type RekeyReport struct {
+	Rewritten  int              `json:"rewritten"`
+	Applied    bool             `json:"applied"`
+	Collisions []RekeyCollision `json:"collisions"`
+}
+
+// rekeyFunc builds the key transformation for req. It returns the new key
+// and whether the key is affected at all.
+func rekeyFunc(req RekeyRequest) (func(string) (string, bool), error) {
+	switch req.Mode {
+	case RekeyAddPrefix:
+		if req.Prefix == "" {
+			return nil, fmt.Errorf("%w: add_prefix needs a prefix", errInvalidRekey)
+		}
+		return func(key string) (string, bool) { return req.Prefix + key, true }, nil
+	case RekeyStripPrefix:
+		if req.Prefix == "" {
+			return nil, fmt.Errorf("%w: strip_prefix needs a prefix", errInvalidRekey)
+		}
+		return func(key string) (string, bool) {
+			if !strings.HasPrefix(key, req.Prefix) {
+				return key, false
+			}
+			return strings.TrimPrefix(key, req.Prefix), true
+		}, nil
+	case RekeyRegexp:
+		re, err := regexp.Compile(req.Pattern)
+		if err != nil || req.Pattern == "" {
+			return nil, fmt.Errorf("%w: regexp needs a valid pattern", errInvalidRekey)
+		}
+		return func(key string) (string, bool) {
+			if !re.MatchString(key) {
+				return key, false
+			}
+			return re.ReplaceAllString(key, req.Replacement), true
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: mode must be add_prefix, strip_prefix or regexp", errInvalidRekey)
+	}
+}
+
+// Rekey renames keys across the whole store in one step under the write
+// lock. Values and per-key metadata (TTL, content type, modification time,
+// history) move with their key. New keys are normalized and validated like
+// any written key. If any two keys would collide, nothing is changed and the
+// collisions are reported instead; if a new key is invalid or the renamed
+// keys would break a prefix quota, nothing is changed and Rekey fails.
+func (kvs *KeyValueStore) Rekey(req RekeyRequest) (RekeyReport, error) {
+	if req.Mode == RekeyStripPrefix {
+		req.Prefix = kvs.normalizePrefix(req.Prefix)
+	}
+	transform, err := rekeyFunc(req)
+	if err != nil {
+		return RekeyReport{}, err
+	}
+
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	report := RekeyReport{Collisions: []RekeyCollision{}}
+	sources := make(map[string][]string, len(kvs.store))
+	renamed := make(map[string]string)
+	for key := range kvs.store {
+		target, affected := transform(key)
+		if affected {
+			target = kvs.normalizeKey(target)
+		}
+		if affected && target != key {
+			if target == "" {
+				return RekeyReport{}, fmt.Errorf("%w: %q would become an empty key", errInvalidRekey, key)
+			}
+			if err := kvs.validateKey(target); err != nil {
+				return RekeyReport{}, err
+			}
+			renamed[key] = target
+		}
+		sources[target] = append(sources[target], key)
+	}
+	report.Rewritten = len(renamed)
+
+	for target, from := range sources {
+		if len(from) > 1 {
+			sort.Strings(from)
+			report.Collisions = append(report.Collisions, RekeyCollision{Key: target, Sources: from})
+		}
+	}
+	sort.Slice(report.Collisions, func(i, j int) bool { return report.Collisions[i].Key < report.Collisions[j].Key })
+	if len(report.Collisions) > 0 || len(renamed) == 0 {
+		return report, nil
+	}
+	if kvs.quotas != nil {
+		if err := kvs.quotas.check(maps.Keys(sources)); err != nil {
+			return RekeyReport{}, err
+		}
+	}
+	if req.DryRun {
+		return report, nil
+	}
+
+	store := make(map[string]string, max(len(kvs.store), kvs.cfg.InitialCapacity))
+	expiries := newExpiryQueue()
+	for key, value := range kvs.store {
+		target := key
+		if to, ok := renamed[key]; ok {
+			target = to
+		}
+		store[target] = value
+		if at, ok := kvs.expiries.get(key); ok {
+			expiries.set(target, at)
+		}
+	}
+	for from, to := range renamed {
+		if ct, ok := kvs.contentTypes[from]; ok {
+			delete(kvs.contentTypes, from)
+			kvs.contentTypes[to] = ct
+		}
+	}
+	renameKeys(kvs.modified, renamed)
+	if kvs.history != nil {
+		// A target may be the name of a deleted key whose history is
+		// still kept; it belongs to that key, not the one renamed onto it.
+		for _, to := range renamed {
+			if kvs.deletedHistory.remove(to) {
+				delete(kvs.history, to)
+			}
+		}
+		renameKeys(kvs.history, renamed)
+	}
+
+	kvs.store = store
+	kvs.expiries = expiries
+	// Every source is logged as deleted before any target is written, as
+	// in renameKeys, since a target can also be a source.
+	for from := range renamed {
+		kvs.logDeleteLocked(from)
+	}
+	for _, to := range renamed {
+		kvs.logKeyLocked(to, store[to])
+	}
+	kvs.rebuildDerivedLocked()
+	kvs.dirty = true
+	kvs.watchers.notifyAll()
+	report.Applied = true
+	return report, nil
+}
+
+// renameKeys moves the entries of m according to renamed. Targets are
+// collision free, but a target may also be a source, so every source is
+// taken out before any target is written.
+func renameKeys[V any](m map[string]V, renamed map[string]string) {
+	moved := make(map[string]V)
+	for from, to := range renamed {
+		if v, ok := m[from]; ok {
+			moved[to] = v
+			delete(m, from)
+		}
+	}
+	for to, v := range moved {
+		m[to] = v
+	}
+}
+
+func (kvs *KeyValueStore) handleRekey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req RekeyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	report, err := kvs.Rekey(req)
+	if errors.Is(err, errInvalidRekey) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: err.Error()}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if len(report.Collisions) > 0 {
+		sendJSONResponse(w, report, http.StatusConflict)
+		return
+	}
+
+	if report.Applied {
+		if err := kvs.requestSave(); err != nil {
+			log.Printf("Error saving to disk after rekey: %v", err)
+			kvs.sendInternalError(w, "Error saving to disk", err)
+			return
+		}
+	}
+	sendJSONResponse(w, report, http.StatusOK)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRekeyNormalizesTargets(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LowercaseKeys = true
+	kvs := newTestStore(t, cfg)
+	if err := kvs.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := kvs.Rekey(RekeyRequest{Mode: RekeyAddPrefix, Prefix: "Legacy:"})
+	if err != nil || !report.Applied || report.Rewritten != 1 {
+		t.Fatalf("Rekey = %+v, %v", report, err)
+	}
+	kvs.mu.RLock()
+	_, stored := kvs.store["legacy:a"]
+	kvs.mu.RUnlock()
+	if !stored {
+		t.Error(`the renamed key wasn't stored as "legacy:a"`)
+	}
+	if got, ok := kvs.Get("LEGACY:A"); !ok || got != "1" {
+		t.Errorf("renamed key reads as %q (found %v), want 1", got, ok)
+	}
+}
+
+func TestRekeyValidatesTargets(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxKeyBytes = 8
+	cfg.PrefixQuotas = map[string]int{"new:": 1}
+	kvs := newTestStore(t, cfg)
+	for _, key := range []string{"a", "b"} {
+		if err := kvs.Set(key, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		req  RekeyRequest
+		want error
+	}{
+		{RekeyRequest{Mode: RekeyAddPrefix, Prefix: "toolong:"}, ErrInvalidKey},
+		{RekeyRequest{Mode: RekeyAddPrefix, Prefix: "new:"}, ErrPrefixQuotaExceeded},
+		{RekeyRequest{Mode: RekeyAddPrefix, Prefix: "new:", DryRun: true}, ErrPrefixQuotaExceeded},
+	}
+	for _, tt := range tests {
+		if _, err := kvs.Rekey(tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("Rekey(%+v) = %v, want %v", tt.req, err, tt.want)
+		}
+		for _, key := range []string{"a", "b"} {
+			if _, ok := kvs.Get(key); !ok {
+				t.Fatalf("Rekey(%+v) moved %s despite failing", tt.req, key)
+			}
+		}
+	}
+
+	report, err := kvs.Rekey(RekeyRequest{Mode: RekeyRegexp, Pattern: "^a$", Replacement: "new:a"})
+	if err != nil || !report.Applied {
+		t.Fatalf("Rekey within the quota = %+v, %v", report, err)
+	}
+	if err := kvs.Set("new:b", "1"); !errors.Is(err, ErrPrefixQuotaExceeded) {
+		t.Errorf("Set over the quota after rekeying: %v, want ErrPrefixQuotaExceeded", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// reloadableFlags are the flags a SIGHUP config reload can change. Every
+// other flag is fixed for the life of the process.
+var reloadableFlags = map[string]bool{
+	"credentials-file": true,
+	"max-key-bytes":    true,
+	"max-value-bytes":  true,
+	"max-ttl":          true,
+	"max-ttl-mode":     true,
+}
+
+// current returns the config with the latest reloaded values of the
+// reloadableFlags settings. Code reading those settings must go through
+// it rather than kvs.cfg, which keeps the startup values. The whole Config
+// is swapped at once, so a request never sees half of a reload.
+func (kvs *KeyValueStore) current() *Config {
+	if cfg := kvs.live.Load(); cfg != nil {
+		return cfg
+	}
+	return &kvs.cfg
+}
+
+// reloadConfig re-reads the -config file and applies its reloadable
+// settings. A setting removed from the file reverts to its default, and the
+// command line and environment still take precedence. Changes to any other
+// flag are logged and ignored. Nothing is applied unless the whole file is
+// valid.
+func (kvs *KeyValueStore) reloadConfig(keys *apiKeyStore) error {
+	settings, err := readConfigFile(kvs.cfg.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	next := kvs.cfg
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	fs.StringVar(&next.CredentialsFile, "credentials-file", next.CredentialsFile, "")
+	fs.IntVar(&next.MaxKeyBytes, "max-key-bytes", next.MaxKeyBytes, "")
+	fs.IntVar(&next.MaxValueBytes, "max-value-bytes", next.MaxValueBytes, "")
+	fs.DurationVar(&next.MaxTTL, "max-ttl", next.MaxTTL, "")
+	fs.StringVar(&next.MaxTTLMode, "max-ttl-mode", next.MaxTTLMode, "")
+	for name := range reloadableFlags {
+		if !kvs.cfg.explicitFlags[name] {
+			fs.Set(name, flag.Lookup(name).DefValue)
+		}
+	}
+
+	var ignored []string
+	for name, value := range settings {
+		f := flag.Lookup(name)
+		switch {
+		case f == nil:
+			return fmt.Errorf("%s: unknown flag -%s", kvs.cfg.ConfigFile, name)
+		case kvs.cfg.explicitFlags[name]:
+			continue
+		case !reloadableFlags[name]:
+			if value != f.Value.String() {
+				ignored = append(ignored, "-"+name)
+			}
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: -%s: %w", kvs.cfg.ConfigFile, name, err)
+		}
+	}
+	if err := validateLimits(next); err != nil {
+		return err
+	}
+	newKeys, err := loadAPIKeys(next.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("loading API keys: %w", err)
+	}
+
+	kvs.live.Store(&next)
+	keys.Store(newKeys)
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		log.Printf("Config reload: ignoring changes to %s, which need a restart", strings.Join(ignored, ", "))
+	}
+	log.Printf("Reloaded %s", kvs.cfg.ConfigFile)
+	return nil
+}
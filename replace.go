@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"maps"
+	"net/http"
+	"time"
+)
+
+// ReplaceAll atomically discards the current contents of the store and
+// installs newStore in their place. Readers observe either the old contents
+// or the new ones, never a mix of both. newStore is validated as a whole
+// first, so if any key or value would be rejected by a write, or the
+// replacement breaks -max-keys or a prefix quota, nothing changes.
+func (kvs *KeyValueStore) ReplaceAll(newStore map[string]string) error {
+	replacement := make(map[string]string, max(len(newStore), kvs.cfg.InitialCapacity))
+	original := make(map[string]string, len(newStore))
+	for key, value := range newStore {
+		normalized := kvs.normalizeKey(key)
+		if normalized == "" {
+			return fmt.Errorf("%w: empty key", ErrInvalidKey)
+		}
+		// Map order is random, so which of two colliding keys won would
+		// differ from one replace to the next.
+		if other, ok := original[normalized]; ok {
+			return fmt.Errorf("%w: %q and %q both normalize to %q", ErrDuplicateKey, other, key, normalized)
+		}
+		if err := kvs.validateKey(normalized); err != nil {
+			return err
+		}
+		if err := kvs.validateValue(value); err != nil {
+			return err
+		}
+		original[normalized] = key
+		replacement[normalized] = value
+	}
+	if kvs.cfg.MaxKeys > 0 && len(replacement) > kvs.cfg.MaxKeys {
+		return fmt.Errorf("%w: replacement has %d keys, limit is %d", ErrStoreFull, len(replacement), kvs.cfg.MaxKeys)
+	}
+	if kvs.quotas != nil {
+		if err := kvs.quotas.check(maps.Keys(replacement)); err != nil {
+			return err
+		}
+	}
+
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	// History is recorded as though each key had been written or deleted
+	// on its own, so replacing the store doesn't lose what keys held.
+	now := time.Now()
+	for key := range kvs.store {
+		if _, kept := replacement[key]; !kept {
+			kvs.recordDeleteHistoryLocked(key, now)
+		}
+	}
+	for key, value := range replacement {
+		if current, exists := kvs.store[key]; !exists || current != value {
+			kvs.recordHistoryLocked(key, value, now)
+		}
+	}
+	kvs.store = replacement
+	kvs.expiries = newExpiryQueue()
+	kvs.contentTypes = make(map[string]string)
+	kvs.modified = make(map[string]time.Time, len(replacement))
+	for key := range replacement {
+		kvs.modified[key] = now
+	}
+	kvs.rebuildDerivedLocked()
+	kvs.logStoreLocked()
+	kvs.dirty = true
+	kvs.watchers.notifyAll()
+	return nil
+}
+
+func (kvs *KeyValueStore) handleReplace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(body, &data); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	for key := range data {
+		if kvs.normalizeKey(key) == "" {
+			sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+			return
+		}
+	}
+	if err := kvs.ReplaceAll(data); err != nil {
+		sendWriteError(w, err)
+		return
+	}
+
+	// A full replacement is usually a deliberate data load, so persist it
+	// right away instead of waiting for the next sync tick.
+	if err := kvs.requestSave(); err != nil {
+		log.Printf("Error saving to disk after replace: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+
+	sendJSONResponse(w, map[string]string{"status": "OK"}, http.StatusOK)
+}
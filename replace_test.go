@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReplaceAllValidates(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LowercaseKeys = true
+	cfg.MaxKeyBytes, cfg.MaxValueBytes = 8, 8
+	cfg.MaxKeys = 3
+	cfg.PrefixQuotas = map[string]int{"user:": 1}
+	kvs := newTestStore(t, cfg)
+	if err := kvs.Set("old", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]string
+		want error
+	}{
+		{"normalization collision", map[string]string{"Key": "1", "key": "2"}, ErrDuplicateKey},
+		{"key too long", map[string]string{"123456789": "1"}, ErrInvalidKey},
+		{"value too large", map[string]string{"k": "123456789"}, ErrValueTooLarge},
+		{"too many keys", map[string]string{"a": "1", "b": "1", "c": "1", "d": "1"}, ErrStoreFull},
+		{"prefix quota", map[string]string{"user:1": "1", "user:2": "1"}, ErrPrefixQuotaExceeded},
+		{"empty key", map[string]string{"": "1"}, ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		if err := kvs.ReplaceAll(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ReplaceAll = %v, want %v", tt.name, err, tt.want)
+		}
+		if got, ok := kvs.Get("old"); !ok || got != "1" || kvs.Count() != 1 {
+			t.Fatalf("%s: a rejected replacement changed the store", tt.name)
+		}
+	}
+
+	if err := kvs.ReplaceAll(map[string]string{"User:1": "a", "B": "b"}); err != nil {
+		t.Fatalf("valid replacement: %v", err)
+	}
+	if _, ok := kvs.Get("old"); ok || kvs.Count() != 2 {
+		t.Errorf("store holds %d keys after replacing, want the 2 new ones", kvs.Count())
+	}
+	if got, _ := kvs.Get("user:1"); got != "a" {
+		t.Errorf("user:1 = %q, want a", got)
+	}
+	// The replacement's own keys count toward the quota.
+	if err := kvs.Set("user:2", "x"); !errors.Is(err, ErrPrefixQuotaExceeded) {
+		t.Errorf("Set over the quota after replacing: %v, want ErrPrefixQuotaExceeded", err)
+	}
+}
+
+func TestHandleReplaceRejectsInvalid(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxValueBytes = 4
+	kvs := newTestStore(t, cfg)
+
+	rec := serve(kvs.handleReplace, http.MethodPost, "/replace", `{"k":"`+strings.Repeat("x", 5)+`"}`)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized value: status %d, want 413: %s", rec.Code, rec.Body)
+	}
+	rec = serve(kvs.handleReplace, http.MethodPost, "/replace", `{"":"v"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty key: status %d, want 400", rec.Code)
+	}
+	rec = serve(kvs.handleReplace, http.MethodPost, "/replace", `{"k":"v"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("valid replacement: status %d: %s", rec.Code, rec.Body)
+	}
+}
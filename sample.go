@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const maxSampleSize = 10000
+
+// SampledKey carries the value, when requested, like GetResponse.
+type SampledKey struct {
+	Key      string  `json:"key"`
+	Value    *string `json:"value,omitempty"`
+	Encoding string  `json:"encoding,omitempty"`
+}
+
+type SampleResponse struct {
+	Total int          `json:"total"`
+	Keys  []SampledKey `json:"keys"`
+}
+
+type RandomKeyResponse struct {
+	Key string `json:"key"`
+}
+
+// SampleKeys returns n live keys chosen uniformly at random, using
+// reservoir sampling so the store is walked once without copying its keys.
+// Values are included when withValues is set. The result is sorted by key.
+func (kvs *KeyValueStore) SampleKeys(n int, withValues bool) SampleResponse {
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	now := time.Now()
+	reservoir := make([]string, 0, n)
+	seen := 0
+	for key := range kvs.store {
+		if kvs.expiries.expired(key, now) {
+			continue
+		}
+		seen++
+		if len(reservoir) < n {
+			reservoir = append(reservoir, key)
+		} else if j := rand.Intn(seen); j < n {
+			reservoir[j] = key
+		}
+	}
+	sort.Strings(reservoir)
+
+	resp := SampleResponse{Total: seen, Keys: make([]SampledKey, len(reservoir))}
+	for i, key := range reservoir {
+		resp.Keys[i].Key = key
+		if withValues {
+			value := kvs.store[key]
+			resp.Keys[i].Value = &value
+		}
+	}
+	return resp
+}
+
+// RandomKey returns one live key chosen uniformly at random, or false if
+// the store is empty. Go maps have no random access, so this walks the map
+// to a random position: O(n) time, n/2 steps on average, and no extra
+// memory. An indexed key slice would make it O(1) but cost memory and work
+// on every write. If the chosen key has expired but not yet been swept,
+// it falls back to a reservoir sample over the live keys.
+func (kvs *KeyValueStore) RandomKey() (string, bool) {
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	if len(kvs.store) == 0 {
+		return "", false
+	}
+
+	now := time.Now()
+	i := rand.Intn(len(kvs.store))
+	for key := range kvs.store {
+		if i > 0 {
+			i--
+			continue
+		}
+		if !kvs.expiries.expired(key, now) {
+			return key, true
+		}
+		break
+	}
+
+	chosen, seen := "", 0
+	for key := range kvs.store {
+		if kvs.expiries.expired(key, now) {
+			continue
+		}
+		seen++
+		if rand.Intn(seen) == 0 {
+			chosen = key
+		}
+	}
+	return chosen, seen > 0
+}
+
+func (kvs *KeyValueStore) handleRandomKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	key, ok := kvs.RandomKey()
+	if !ok {
+		sendJSONResponse(w, ErrorResponse{Code: CodeKeyNotFound, Error: "Store is empty"}, http.StatusNotFound)
+		return
+	}
+	sendJSONResponse(w, RandomKeyResponse{Key: key}, http.StatusOK)
+}
+
+func (kvs *KeyValueStore) handleSampleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	n := 20
+	if s := r.URL.Query().Get("sample"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > maxSampleSize {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "sample must be between 1 and " + strconv.Itoa(maxSampleSize)}, http.StatusBadRequest)
+			return
+		}
+		n = v
+	}
+	withValues, _ := strconv.ParseBool(r.URL.Query().Get("values"))
+
+	resp := kvs.SampleKeys(n, withValues)
+	for i, k := range resp.Keys {
+		if k.Value != nil {
+			encoded, encoding := encodeValue(*k.Value)
+			resp.Keys[i].Value, resp.Keys[i].Encoding = &encoded, encoding
+		}
+	}
+	sendJSONResponse(w, resp, http.StatusOK)
+}
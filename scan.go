@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultScanCount = 100
+	maxScanCount     = 10000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type ScanResponse struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor"`
+}
+
+// Scan returns up to count live keys that start with prefix and sort after
+// the key after, in sorted order, and the key to resume from, or "" once no
+// keys remain.
+// Resuming from a key rather than an offset means keys created or deleted
+// between pages never cause a surviving key to be skipped or repeated.
+func (kvs *KeyValueStore) Scan(prefix, after string, count int) ([]string, string) {
+	prefix = kvs.normalizePrefix(prefix)
+	keys := withReadSnapshot(kvs, func(now time.Time) []string {
+		var keys []string
+		for key := range kvs.store {
+			if key > after && strings.HasPrefix(key, prefix) && !kvs.expiries.expired(key, now) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	})
+
+	sort.Strings(keys)
+	if len(keys) <= count {
+		return keys, ""
+	}
+	keys = keys[:count]
+	return keys, keys[count-1]
+}
+
+// encodeScanCursor and decodeScanCursor turn the resume key into an opaque
+// cursor that is safe in a query string. The cursor "0" starts a scan.
+func encodeScanCursor(after string) string {
+	if after == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(after))
+}
+
+func decodeScanCursor(cursor string) (string, error) {
+	if cursor == "" || cursor == "0" {
+		return "", nil
+	}
+	after, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(after) == 0 {
+		return "", errInvalidCursor
+	}
+	return string(after), nil
+}
+
+func (kvs *KeyValueStore) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	after, err := decodeScanCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid cursor"}, http.StatusBadRequest)
+		return
+	}
+
+	count := defaultScanCount
+	if s := r.URL.Query().Get("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxScanCount {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid count"}, http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+
+	keys, next := kvs.Scan(r.URL.Query().Get("prefix"), after, count)
+	if keys == nil {
+		keys = []string{}
+	}
+	sendJSONResponse(w, ScanResponse{Keys: keys, Cursor: encodeScanCursor(next)}, http.StatusOK)
+}
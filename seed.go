@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// loadSeedFile merges the key/values in path into the store. Keys already
+// loaded from the data file win unless overwrite is set. The seed file is only
+// ever read; seeded keys are persisted to the data file like any other write.
+func (kvs *KeyValueStore) loadSeedFile(path string, overwrite bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var seed map[string]string
+	if err := json.Unmarshal(data, &seed); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	strategy := MergeKeepExisting
+	if overwrite {
+		strategy = MergeOverwrite
+	}
+	report, err := kvs.Merge(seed, strategy, time.Time{})
+	if err != nil {
+		return fmt.Errorf("applying %s: %w", path, err)
+	}
+	log.Printf("Seeded from %s: %d added, %d overwritten, %d skipped", path, report.Added, report.Overwritten, report.Skipped)
+	return nil
+}
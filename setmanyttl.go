@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// SetTTLEntry is one write in a /set_many_ttl request. A TTLSeconds of zero
+// stores the key without an expiry.
+type SetTTLEntry struct {
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+type SetManyTTLResponse struct {
+	Status string `json:"status"`
+	Set    int    `json:"set"`
+}
+
+// SetManyTTL applies entries in order under one write lock, giving each key
+// its own TTL. Every entry is validated first, so either all of them are
+// written or none are. A key that appears more than once is rejected with
+// ErrDuplicateKey, or with -batch-duplicates last-wins the last entry wins.
+func (kvs *KeyValueStore) SetManyTTL(entries []SetTTLEntry) error {
+	keys := make([]string, len(entries))
+	ttls := make([]time.Duration, len(entries))
+	for i, e := range entries {
+		keys[i] = kvs.normalizeKey(e.Key)
+		if err := kvs.validateKey(keys[i]); err != nil {
+			return err
+		}
+		if err := kvs.validateValue(e.Value); err != nil {
+			return err
+		}
+		if e.TTLSeconds < 0 {
+			return fmt.Errorf("entry %d: ttl_seconds must not be negative", i)
+		}
+		ttl, err := kvs.capTTL(time.Duration(e.TTLSeconds) * time.Second)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+		ttls[i] = ttl
+	}
+	if err := kvs.checkDuplicateKeys(make(map[string]bool, len(keys)), keys...); err != nil {
+		return err
+	}
+
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	if err := kvs.checkQuotaLocked(keys...); err != nil {
+		return err
+	}
+	if err := kvs.checkCapacityLocked(keys...); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, e := range entries {
+		if err := kvs.setLocked(keys[i], e.Value); err != nil {
+			return err
+		}
+		if ttls[i] > 0 {
+			kvs.expireLocked(keys[i], ttls[i], now)
+		}
+	}
+	return nil
+}
+
+func (kvs *KeyValueStore) handleSetManyTTL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var entries []SetTTLEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+	for _, e := range entries {
+		if kvs.normalizeKey(e.Key) == "" {
+			sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := kvs.SetManyTTL(entries); err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, SetManyTTLResponse{Status: "OK", Set: len(entries)}, http.StatusOK)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// totalSlots and keySlot mirror client.TotalSlots and client.KeySlot.
+const totalSlots = 16384
+
+func keySlot(key string) int {
+	return int(crc32.ChecksumIEEE([]byte(key)) % totalSlots)
+}
+
+// SlotRange is an inclusive range of hash slots.
+type SlotRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// parseSlotRanges parses a comma-separated list of slots and inclusive
+// ranges, such as "0-8191,10000".
+func parseSlotRanges(s string) ([]SlotRange, error) {
+	var ranges []SlotRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			endStr = startStr
+		}
+		start, err1 := strconv.Atoi(startStr)
+		end, err2 := strconv.Atoi(endStr)
+		if err1 != nil || err2 != nil || start < 0 || end < start || end >= totalSlots {
+			return nil, fmt.Errorf("invalid slot range %q", part)
+		}
+		ranges = append(ranges, SlotRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+type ShardInfoResponse struct {
+	NodeID     string      `json:"node_id"`
+	TotalSlots int         `json:"total_slots"`
+	Slots      []SlotRange `json:"slots"`
+	Key        string      `json:"key,omitempty"`
+	KeySlot    *int        `json:"key_slot,omitempty"`
+	Owned      *bool       `json:"owned,omitempty"`
+}
+
+// ownsSlot reports whether slot falls in this node's assignment.
+func (kvs *KeyValueStore) ownsSlot(slot int) bool {
+	for _, r := range kvs.cfg.ShardSlots {
+		if slot >= r.Start && slot <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// handleShardInfo reports this node's slot assignment. With ?key= it also
+// reports which slot the key hashes to and whether this node owns it.
+func (kvs *KeyValueStore) handleShardInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	resp := ShardInfoResponse{
+		NodeID:     kvs.cfg.ShardNodeID,
+		TotalSlots: totalSlots,
+		Slots:      kvs.cfg.ShardSlots,
+	}
+	if key := r.URL.Query().Get("key"); key != "" {
+		key = kvs.normalizeKey(key)
+		slot := keySlot(key)
+		owned := kvs.ownsSlot(slot)
+		resp.Key, resp.KeySlot, resp.Owned = key, &slot, &owned
+	}
+	sendJSONResponse(w, resp, http.StatusOK)
+}
@@ -0,0 +1,33 @@
+package main
+
+import "time"
+
+// withReadSnapshot runs read under the store's read lock, passing the time
+// to judge expiry by, and returns whatever read copied out. Read endpoints
+// follow this shape: copy the value or entries they need while locked, then
+// encode and write the response once the lock is released, so a slow client
+// or a large encode never holds up writers. read must not do I/O or return
+// references into the store's maps.
+func withReadSnapshot[T any](kvs *KeyValueStore, read func(now time.Time) T) T {
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	return read(time.Now())
+}
+
+// snapshotEntries copies the live entries whose keys satisfy match, stopping
+// after limit entries if limit is positive. Which entries a limited
+// snapshot keeps is unspecified.
+func (kvs *KeyValueStore) snapshotEntries(match func(key string) bool, limit int) map[string]string {
+	return withReadSnapshot(kvs, func(now time.Time) map[string]string {
+		result := make(map[string]string)
+		for key, value := range kvs.store {
+			if limit > 0 && len(result) == limit {
+				break
+			}
+			if match(key) && !kvs.expiries.expired(key, now) {
+				result[key] = value
+			}
+		}
+		return result
+	})
+}
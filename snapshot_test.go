@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeProbe is a ResponseWriter that, on the first write of the body,
+// makes a write to the store and waits for it. A handler still holding the
+// read lock while it writes its response would block that write.
+type writeProbe struct {
+	*httptest.ResponseRecorder
+	t      *testing.T
+	kvs    *KeyValueStore
+	probed bool
+}
+
+func (p *writeProbe) Write(b []byte) (int, error) {
+	if !p.probed {
+		p.probed = true
+		done := make(chan error, 1)
+		go func() { done <- p.kvs.Set("probe", "x") }()
+		select {
+		case err := <-done:
+			if err != nil {
+				p.t.Errorf("probe write: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			p.t.Fatal("a write blocked while the response was being written: the lock is still held")
+		}
+	}
+	return p.ResponseRecorder.Write(b)
+}
+
+func TestReadHandlersReleaseLockBeforeWriting(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	for i := 0; i < 1000; i++ {
+		if err := kvs.Set("key"+strconv.Itoa(i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		handler http.HandlerFunc
+		target  string
+	}{
+		{kvs.handleDump, "/dump"},
+		{kvs.handleDump, "/dump?prefix=key1"},
+		{kvs.handleGet, "/get?key=key1"},
+	} {
+		probe := &writeProbe{ResponseRecorder: httptest.NewRecorder(), t: t, kvs: kvs}
+		tt.handler(probe, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if probe.Code != http.StatusOK || !probe.probed {
+			t.Errorf("%s: status %d, body written: %v", tt.target, probe.Code, probe.probed)
+		}
+	}
+}
+
+func TestWithReadSnapshot(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := withReadSnapshot(kvs, func(now time.Time) string {
+		if kvs.mu.TryLock() {
+			kvs.mu.Unlock()
+			t.Error("read ran without the read lock held")
+		}
+		return kvs.store["a"]
+	})
+	if got != "1" {
+		t.Errorf("withReadSnapshot returned %q, want 1", got)
+	}
+	if !kvs.mu.TryLock() {
+		t.Fatal("withReadSnapshot returned with the lock still held")
+	}
+	kvs.mu.Unlock()
+
+	if n := len(kvs.snapshotEntries(func(string) bool { return true }, 1)); n != 1 {
+		t.Errorf("snapshotEntries with limit 1 returned %d entries", n)
+	}
+}
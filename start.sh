@@ -1,3 +1,3 @@
 #!/bin/bash
-go run main.go &
+go run *.go "$@" &
 echo "Server started."
\ No newline at end of file
@@ -0,0 +1,46 @@
+package main
+
+import "net/http"
+
+type InternStats struct {
+	UniqueValues int   `json:"unique_values"`
+	BytesSaved   int64 `json:"bytes_saved"`
+}
+
+type StatsResponse struct {
+	Keys      int          `json:"keys"`
+	Sets      uint64       `json:"sets"`
+	Gets      uint64       `json:"gets"`
+	Deletes   uint64       `json:"deletes"`
+	Evictions uint64       `json:"evictions"`
+	Intern    *InternStats `json:"interning,omitempty"`
+}
+
+// Stats returns a point-in-time summary of the store.
+func (kvs *KeyValueStore) Stats() StatsResponse {
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	stats := StatsResponse{
+		Keys:      len(kvs.store),
+		Sets:      kvs.ops.sets.Load(),
+		Gets:      kvs.ops.gets.Load(),
+		Deletes:   kvs.ops.deletes.Load(),
+		Evictions: kvs.ops.evictions.Load(),
+	}
+	if kvs.interner != nil {
+		stats.Intern = &InternStats{
+			UniqueValues: len(kvs.interner.values),
+			BytesSaved:   kvs.interner.saved,
+		}
+	}
+	return stats
+}
+
+func (kvs *KeyValueStore) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	sendJSONResponse(w, kvs.Stats(), http.StatusOK)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+var (
+	errDuplicateJSONKey = errors.New("duplicate key in JSON object")
+	errTrailingJSON     = errors.New("unexpected data after JSON value")
+)
+
+// decodeStrictJSON is json.Unmarshal without its lenient corners: a body
+// that repeats a field (where Unmarshal silently keeps the last one) or
+// has anything after the first JSON value is rejected instead of being
+// partially accepted.
+func decodeStrictJSON(data []byte, v interface{}) error {
+	if err := checkDuplicateJSONKeys(data); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// dec.More only looks for another array or object element, so it
+	// misses a stray "}" or "]"; asking for one more token catches both.
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingJSON
+	}
+	return nil
+}
+
+// checkDuplicateJSONKeys walks data's tokens and fails on the first object,
+// at any depth, that names the same field twice. Field names are compared
+// case-insensitively, as encoding/json matches them to struct fields, so
+// {"key": "a", "KEY": "b"} is a duplicate too. Syntax errors are left for
+// the real decode to report.
+func checkDuplicateJSONKeys(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	// Each open container is an entry on the stack; objects carry the set
+	// of fields seen so far, arrays carry nil.
+	var stack []map[string]bool
+	expectKey := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, make(map[string]bool))
+				expectKey = true
+				continue
+			case '[':
+				stack = append(stack, nil)
+				expectKey = false
+				continue
+			default:
+				stack = stack[:len(stack)-1]
+			}
+		case string:
+			if expectKey {
+				fields, name := stack[len(stack)-1], foldName(t)
+				if fields[name] {
+					return fmt.Errorf("%w: %q", errDuplicateJSONKey, t)
+				}
+				fields[name] = true
+				expectKey = false
+				continue
+			}
+		}
+
+		if len(stack) == 0 {
+			return nil
+		}
+		// A value just finished; inside an object the next token is a key.
+		expectKey = stack[len(stack)-1] != nil
+	}
+}
+
+// foldName returns a canonical case-folded form of name, so two names that
+// encoding/json would match to the same field compare equal.
+func foldName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		// SimpleFold cycles through a rune's case variants; the smallest
+		// is as good a representative as any.
+		folded := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			folded = min(folded, f)
+		}
+		b.WriteRune(folded)
+	}
+	return b.String()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStrictJSON(t *testing.T) {
+	tests := []struct {
+		body string
+		want error
+	}{
+		{`{"key":"a","value":"b"}`, nil},
+		{`{"key":{"key":1},"value":"b"}`, nil},
+		{`{"key":{"key":1,"KEY":2}}`, errDuplicateJSONKey},
+		{`{"key":"a","key":"b"}`, errDuplicateJSONKey},
+		{`{"key":"a","KEY":"b"}`, errDuplicateJSONKey},
+		{`{"Value":"a","vALUE":"b","key":"k"}`, errDuplicateJSONKey},
+		{`{"key":"a","value":"b"} x`, errTrailingJSON},
+		{`{"key":"a","value":"b"}}`, errTrailingJSON},
+		{`{"key":"a","value":"b"}{}`, errTrailingJSON},
+	}
+	for _, tt := range tests {
+		var v any
+		err := decodeStrictJSON([]byte(tt.body), &v)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("decodeStrictJSON(%s) = %v, want %v", tt.body, err, tt.want)
+		}
+	}
+}
+
+func TestHandleSetRejectsOversized(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxKeyBytes, cfg.MaxValueBytes = 8, 16
+	kvs := newTestStore(t, cfg)
+
+	for _, body := range []string{
+		`{"key":"123456789","value":"v"}`,
+		`{"key":"k","value":"12345678901234567"}`,
+		`{"key":"k","value":"` + strings.Repeat(`A`, 17) + `"}`,
+	} {
+		rec := serve(kvs.handleSet, http.MethodPost, "/set", body)
+		if rec.Code < 400 || rec.Code >= 500 {
+			t.Errorf("%s: status %d, want 4xx", body, rec.Code)
+		}
+	}
+	if n := kvs.Count(); n != 0 {
+		t.Errorf("%d keys stored, want 0", n)
+	}
+}
+
+func TestMaxSetBodyBytesWithOneLimit(t *testing.T) {
+	tests := []struct {
+		keyBytes, valueBytes int
+		want                 int64
+	}{
+		{0, 0, -1},
+		{8, 16, 6*(8+16) + 4096},
+		{0, 16, 6*(setBodyKeyAllowance+16) + 4096},
+		{8, 0, 6*(8+maxValueExtent) + 4096},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t)
+		cfg.MaxKeyBytes, cfg.MaxValueBytes = tt.keyBytes, tt.valueBytes
+		kvs := newTestStore(t, cfg)
+		if got := kvs.maxSetBodyBytes(); got != tt.want {
+			t.Errorf("maxSetBodyBytes with key limit %d, value limit %d = %d, want %d", tt.keyBytes, tt.valueBytes, got, tt.want)
+		}
+	}
+
+	// With only a value limit, a body padded past the key allowance is cut
+	// off before it is read in full.
+	cfg := testConfig(t)
+	cfg.MaxValueBytes = 16
+	kvs := newTestStore(t, cfg)
+	body := `{"key":"k","value":"v","pad":"` + strings.Repeat("x", int(kvs.maxSetBodyBytes())) + `"}`
+	if rec := serve(kvs.handleSet, http.MethodPost, "/set", body); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body with only -max-value-bytes: status %d, want 413", rec.Code)
+	}
+}
+
+// FuzzHandleSet checks that no request body gets /set to fail with anything
+// but a clean 4xx ErrorResponse, and that an accepted body stores exactly
+// the value a plain decode of it holds.
+func FuzzHandleSet(f *testing.F) {
+	for _, seed := range []string{
+		`{"key":"a","value":"b"}`,
+		`{"key":"a","KEY":"b","value":"c"}`,
+		`{"key":"a","value":"b"} trailing`,
+		`{"key":"a","value":"\ud800"}`,
+		`{"key":"","value":"b"}`,
+		`{"key":"a","value":"b","content_type":"text/plain"}`,
+		`[{"key":"a"}]`,
+		`{"key":"a","value":1}`,
+		``,
+	} {
+		f.Add(seed)
+	}
+
+	cfg := testConfig(f)
+	cfg.MaxKeyBytes, cfg.MaxValueBytes = 64, 256
+	kvs := newTestStore(f, cfg)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		rec := serve(kvs.handleSet, http.MethodPost, "/set", body)
+		if rec.Code != http.StatusOK {
+			var resp ErrorResponse
+			if rec.Code < 400 || rec.Code >= 500 {
+				t.Fatalf("status %d for %q", rec.Code, body)
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code == "" {
+				t.Fatalf("status %d without an ErrorResponse for %q: %s", rec.Code, body, rec.Body)
+			}
+			return
+		}
+
+		var req SetRequest
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatalf("accepted a body json.Unmarshal rejects: %q", body)
+		}
+		if err := checkDuplicateJSONKeys([]byte(body)); err != nil {
+			t.Fatalf("accepted a body with duplicate fields: %q", body)
+		}
+		if got, ok := kvs.Get(req.Key); !ok || got != req.Value {
+			t.Fatalf("stored %q (found %v), want %q for %q", got, ok, req.Value, body)
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	traceBatchSize     = 512
+	traceQueueSize     = 4096
+	traceFlushInterval = 5 * time.Second
+	traceScopeName     = "github.com/razamobin/go-key-value-store"
+)
+
+// OTLP span kinds.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+)
+
+// span is a finished span waiting to be exported: a server span for a
+// request, or an internal one for a store operation within it.
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	kind     int
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+	status   int
+}
+
+// traceContextKey is the context key for the request's traceParent.
+type traceContextKey struct{}
+
+// traceParent identifies the request span that store operation spans
+// belong to.
+type traceParent struct {
+	te      *traceExporter
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+// startSpan starts an internal span named name as a child of the request
+// span in ctx, and returns the function that ends and records it. Without
+// a request span in ctx, as when tracing is off, it does nothing.
+func startSpan(ctx context.Context, name, key string) (end func()) {
+	parent, ok := ctx.Value(traceContextKey{}).(traceParent)
+	if !ok {
+		return func() {}
+	}
+	s := span{traceID: parent.traceID, parentID: parent.spanID, kind: spanKindInternal, name: name, start: time.Now()}
+	rand.Read(s.spanID[:])
+	return func() {
+		s.end = time.Now()
+		s.attrs = map[string]string{"kv.operation": name}
+		if key != "" {
+			s.attrs["kv.key"] = key
+		}
+		parent.te.record(s)
+	}
+}
+
+// traceExporter batches spans and posts them to an OpenTelemetry collector
+// using OTLP/HTTP with JSON encoding, so no SDK dependency is needed.
+type traceExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	spans       chan span
+}
+
+// newTraceExporterFromEnv configures an exporter from the standard
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT / OTEL_EXPORTER_OTLP_ENDPOINT and
+// OTEL_SERVICE_NAME variables. It returns nil if no endpoint is set.
+func newTraceExporterFromEnv() *traceExporter {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "go-key-value-store"
+	}
+
+	return &traceExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		spans:       make(chan span, traceQueueSize),
+	}
+}
+
+// record queues a span for export. If the queue is full the span is
+// dropped rather than slowing down the request path.
+func (te *traceExporter) record(s span) {
+	select {
+	case te.spans <- s:
+	default:
+	}
+}
+
+// run exports queued spans in batches until ctx is cancelled, then flushes
+// whatever is left.
+func (te *traceExporter) run(ctx context.Context) {
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]span, 0, traceBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := te.export(batch); err != nil {
+			log.Printf("Error exporting %d spans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-te.spans:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case s := <-te.spans:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (te *traceExporter) export(batch []span) error {
+	type anyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	type keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	type otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []keyValue     `json:"attributes"`
+		Status            map[string]int `json:"status"`
+	}
+
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            map[string]int{"code": 0}, // STATUS_CODE_UNSET
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for k, v := range s.attrs {
+			out.Attributes = append(out.Attributes, keyValue{Key: k, Value: anyValue{StringValue: v}})
+		}
+		if s.status >= 500 {
+			out.Status["code"] = 2 // STATUS_CODE_ERROR
+		}
+		spans = append(spans, out)
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []keyValue{{Key: "service.name", Value: anyValue{StringValue: te.serviceName}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": traceScopeName},
+				"spans": spans,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := te.client.Post(te.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// parseTraceparent extracts the trace and parent span IDs from a W3C
+// traceparent header ("00-<trace-id>-<span-id>-<flags>").
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceID, parentID, false
+	}
+	if n, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || n != 16 || traceID == [16]byte{} {
+		return traceID, parentID, false
+	}
+	if n, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || n != 8 || parentID == [8]byte{} {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, true
+}
+
+// tracingMiddleware records one server span per request, continuing the
+// caller's trace when a valid traceparent header is present, and puts it in
+// the request context so handlers can add store operation spans under it
+// with startSpan. Spans are named by route pattern rather than path, which
+// for /kv/{key...} would make every key a span name of its own; the key is
+// recorded as an attribute instead.
+func (te *traceExporter) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := span{kind: spanKindServer, start: time.Now()}
+		if traceID, parentID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			s.traceID, s.parentID = traceID, parentID
+		} else {
+			rand.Read(s.traceID[:])
+		}
+		rand.Read(s.spanID[:])
+
+		// The mux records the matched pattern and path values on the
+		// request it is handed, so keep that one to read them back.
+		r = r.WithContext(context.WithValue(r.Context(), traceContextKey{}, traceParent{te: te, traceID: s.traceID, spanID: s.spanID}))
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		s.end = time.Now()
+		s.status = rec.status
+		s.name = r.Method + " " + route
+		s.attrs = map[string]string{
+			"http.request.method":       r.Method,
+			"http.route":                route,
+			"url.path":                  r.URL.Path,
+			"http.response.status_code": strconv.Itoa(rec.status),
+			"kv.operation":              strings.Trim(route, "/"),
+		}
+		if key := requestKey(r); key != "" {
+			s.attrs["kv.key"] = key
+		}
+		te.record(s)
+	})
+}
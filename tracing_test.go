@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// tracedRequest serves one request through the tracing middleware and
+// returns the spans it recorded, store operations first.
+func tracedRequest(t *testing.T, kvs *KeyValueStore, req *http.Request) []span {
+	t.Helper()
+	te := &traceExporter{spans: make(chan span, 16)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get", kvs.handleGet)
+	mux.HandleFunc("/kv/{key...}", kvs.handleKV)
+	te.tracingMiddleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	close(te.spans)
+	var spans []span
+	for s := range te.spans {
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func TestTracingNamesSpansByRoute(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("users/42", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracedRequest(t, kvs, httptest.NewRequest(http.MethodGet, "/kv/users/42", nil))
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want a store span and a server span", len(spans))
+	}
+	op, server := spans[0], spans[1]
+	if server.name != "GET /kv/{key...}" || server.attrs["kv.operation"] != "kv/{key...}" {
+		t.Errorf("server span %q with operation %q, want the route pattern", server.name, server.attrs["kv.operation"])
+	}
+	if server.attrs["kv.key"] != "users/42" {
+		t.Errorf("server span kv.key = %q, want users/42", server.attrs["kv.key"])
+	}
+	if op.name != "store.Get" || op.kind != spanKindInternal || op.attrs["kv.key"] != "users/42" {
+		t.Errorf("store span = %q kind %d key %q", op.name, op.kind, op.attrs["kv.key"])
+	}
+	if op.traceID != server.traceID || op.parentID != server.spanID {
+		t.Error("store span is not a child of the server span")
+	}
+}
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	req := httptest.NewRequest(http.MethodGet, "/get?key=missing", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	spans := tracedRequest(t, kvs, req)
+	server := spans[len(spans)-1]
+	if got := hex.EncodeToString(server.traceID[:]); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID %s, want the caller's", got)
+	}
+	if got := hex.EncodeToString(server.parentID[:]); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID %s, want the caller's", got)
+	}
+	if server.name != "GET /get" {
+		t.Errorf("server span %q, want GET /get", server.name)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sweepInterval = time.Second
+
+// TTL cap modes decide what a TTL longer than -max-ttl does.
+const (
+	// TTLCapClamp shortens the TTL to -max-ttl.
+	TTLCapClamp = "clamp"
+	// TTLCapReject fails the write.
+	TTLCapReject = "reject"
+)
+
+// ErrTTLTooLong is returned when a TTL exceeds -max-ttl in reject mode.
+var ErrTTLTooLong = errors.New("ttl exceeds maximum")
+
+// expiryItem is one key's expiration in the expiry queue.
+type expiryItem struct {
+	key   string
+	at    time.Time
+	index int
+}
+
+// expiryQueue is a min-heap of expiration times with an index by key, so
+// the next key to expire is always at the front and a key's expiration can
+// be changed or removed in O(log n). It is guarded by kvs.mu.
+type expiryQueue struct {
+	items []*expiryItem
+	byKey map[string]*expiryItem
+}
+
+func newExpiryQueue() *expiryQueue {
+	return &expiryQueue{byKey: make(map[string]*expiryItem)}
+}
+
+func (q *expiryQueue) Len() int           { return len(q.items) }
+func (q *expiryQueue) Less(i, j int) bool { return q.items[i].at.Before(q.items[j].at) }
+func (q *expiryQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
+}
+
+func (q *expiryQueue) Push(x interface{}) {
+	item := x.(*expiryItem)
+	item.index = len(q.items)
+	q.items = append(q.items, item)
+}
+
+func (q *expiryQueue) Pop() interface{} {
+	last := q.items[len(q.items)-1]
+	q.items[len(q.items)-1] = nil
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+// set schedules key to expire at the given time, replacing any earlier
+// expiration.
+func (q *expiryQueue) set(key string, at time.Time) {
+	if item, ok := q.byKey[key]; ok {
+		item.at = at
+		heap.Fix(q, item.index)
+		return
+	}
+	item := &expiryItem{key: key, at: at}
+	heap.Push(q, item)
+	q.byKey[key] = item
+}
+
+// remove clears key's expiration and reports whether it had one.
+func (q *expiryQueue) remove(key string) bool {
+	item, ok := q.byKey[key]
+	if !ok {
+		return false
+	}
+	heap.Remove(q, item.index)
+	delete(q.byKey, key)
+	return true
+}
+
+func (q *expiryQueue) get(key string) (time.Time, bool) {
+	item, ok := q.byKey[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return item.at, true
+}
+
+// expired reports whether key has an expiration at or before now.
+func (q *expiryQueue) expired(key string, now time.Time) bool {
+	item, ok := q.byKey[key]
+	return ok && !item.at.After(now)
+}
+
+// popExpired removes and returns every key whose expiration is at or
+// before now.
+func (q *expiryQueue) popExpired(now time.Time) []string {
+	var keys []string
+	for len(q.items) > 0 && !q.items[0].at.After(now) {
+		item := heap.Pop(q).(*expiryItem)
+		delete(q.byKey, item.key)
+		keys = append(keys, item.key)
+	}
+	return keys
+}
+
+// lookupLocked returns key's value, treating keys whose TTL has passed as
+// missing even if the sweeper has not removed them yet. Callers must hold
+// kvs.mu.
+func (kvs *KeyValueStore) lookupLocked(key string, now time.Time) (string, bool) {
+	value, ok := kvs.store[key]
+	if !ok || kvs.expiries.expired(key, now) {
+		return "", false
+	}
+	return value, true
+}
+
+// capTTL applies -max-ttl to a requested TTL, returning it clamped or an
+// ErrTTLTooLong depending on -max-ttl-mode.
+func (kvs *KeyValueStore) capTTL(ttl time.Duration) (time.Duration, error) {
+	cfg := kvs.current()
+	limit := cfg.MaxTTL
+	if limit <= 0 || ttl <= limit {
+		return ttl, nil
+	}
+	if cfg.MaxTTLMode == TTLCapReject {
+		return 0, fmt.Errorf("%w: %v exceeds limit of %v", ErrTTLTooLong, ttl, limit)
+	}
+	return limit, nil
+}
+
+// expireLocked sets key to expire after ttl. Callers must hold kvs.mu for
+// writing.
+func (kvs *KeyValueStore) expireLocked(key string, ttl time.Duration, now time.Time) {
+	kvs.expiries.set(key, now.Add(ttl))
+	kvs.logExpireLocked(key, now.Add(ttl))
+	kvs.dirty = true
+}
+
+// ExpirePrefix sets a TTL on every live key that starts with prefix and
+// returns how many keys were affected. Keys keep their values until the
+// TTL passes, giving clients a grace period before the namespace is gone.
+func (kvs *KeyValueStore) ExpirePrefix(prefix string, ttl time.Duration) (int, error) {
+	prefix = kvs.normalizePrefix(prefix)
+	ttl, err := kvs.capTTL(ttl)
+	if err != nil {
+		return 0, err
+	}
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for key := range kvs.store {
+		if strings.HasPrefix(key, prefix) && !kvs.expiries.expired(key, now) {
+			kvs.expireLocked(key, ttl, now)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// sweepExpired deletes every key whose TTL has passed and returns how many
+// were removed.
+func (kvs *KeyValueStore) sweepExpired() int {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	return kvs.sweepExpiredLocked(time.Now())
+}
+
+// sweepExpiredLocked is sweepExpired for callers that already hold kvs.mu
+// for writing.
+func (kvs *KeyValueStore) sweepExpiredLocked(now time.Time) int {
+	removed := 0
+	for _, key := range kvs.expiries.popExpired(now) {
+		if kvs.deleteLocked(key) {
+			removed++
+		}
+	}
+	return removed
+}
+
+func (kvs *KeyValueStore) startExpiryRoutine(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			kvs.sweepExpired()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type FlushExpiredResponse struct {
+	Status  string `json:"status"`
+	Removed int    `json:"removed"`
+}
+
+// handleFlushExpired runs the expiry sweep now rather than waiting for the
+// next tick, e.g. so a snapshot taken straight after holds no expired keys.
+func (kvs *KeyValueStore) handleFlushExpired(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	removed := kvs.sweepExpired()
+	if removed > 0 {
+		if err := kvs.persistWrite(r.Context()); err != nil {
+			log.Printf("Error saving to disk: %v", err)
+			kvs.sendInternalError(w, "Error saving to disk", err)
+			return
+		}
+	}
+	sendJSONResponse(w, FlushExpiredResponse{Status: "OK", Removed: removed}, http.StatusOK)
+}
+
+type ExpirePrefixRequest struct {
+	Prefix     string `json:"prefix"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+type ExpirePrefixResponse struct {
+	Status  string `json:"status"`
+	Expired int    `json:"expired"`
+}
+
+func (kvs *KeyValueStore) handleExpirePrefix(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req ExpirePrefixRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	// Require a prefix so a forgotten field can't schedule the whole store
+	// for expiry.
+	if req.Prefix == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Missing prefix"}, http.StatusBadRequest)
+		return
+	}
+	if req.TTLSeconds <= 0 {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "ttl_seconds must be positive"}, http.StatusBadRequest)
+		return
+	}
+
+	count, err := kvs.ExpirePrefix(req.Prefix, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+	if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	sendJSONResponse(w, ExpirePrefixResponse{Status: "OK", Expired: count}, http.StatusOK)
+}
+
+// before returns the items expiring at or before deadline, soonest first.
+// It walks the heap from the root and skips any subtree whose root is past
+// the deadline, since no descendant can expire earlier than its parent, so
+// the cost is proportional to the number of matches rather than the size
+// of the queue.
+func (q *expiryQueue) before(deadline time.Time) []*expiryItem {
+	var matches []*expiryItem
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(q.items) || q.items[i].at.After(deadline) {
+			continue
+		}
+		matches = append(matches, q.items[i])
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].at.Before(matches[j].at) })
+	return matches
+}
+
+type ExpiringKey struct {
+	Key        string    `json:"key"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	TTLSeconds float64   `json:"ttl_seconds"`
+}
+
+type ExpiringResponse struct {
+	Keys []ExpiringKey `json:"keys"`
+}
+
+// Expiring returns the live keys that will expire within the given window,
+// soonest first.
+func (kvs *KeyValueStore) Expiring(within time.Duration) []ExpiringKey {
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	now := time.Now()
+	keys := []ExpiringKey{}
+	for _, item := range kvs.expiries.before(now.Add(within)) {
+		if !item.at.After(now) {
+			continue // already expired, waiting for the sweeper
+		}
+		keys = append(keys, ExpiringKey{
+			Key:        item.key,
+			ExpiresAt:  item.at,
+			TTLSeconds: item.at.Sub(now).Seconds(),
+		})
+	}
+	return keys
+}
+
+func (kvs *KeyValueStore) handleExpiring(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	within, err := time.ParseDuration(r.URL.Query().Get("within"))
+	if err != nil || within < 0 {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid within"}, http.StatusBadRequest)
+		return
+	}
+
+	sendJSONResponse(w, ExpiringResponse{Keys: kvs.Expiring(within)}, http.StatusOK)
+}
+
+// Special /ttl results, matching Redis TTL.
+const (
+	ttlNoExpiry = -1
+	ttlMissing  = -2
+)
+
+type TTLResponse struct {
+	Key        string `json:"key"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+// TTL returns how long key has left to live and whether it exists. A key
+// without an expiry reports a negative duration.
+func (kvs *KeyValueStore) TTL(key string) (time.Duration, bool) {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	now := time.Now()
+	if _, ok := kvs.lookupLocked(key, now); !ok {
+		return 0, false
+	}
+	at, ok := kvs.expiries.get(key)
+	if !ok {
+		return -1, true
+	}
+	return at.Sub(now), true
+}
+
+func (kvs *KeyValueStore) handleTTL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	resp := TTLResponse{Key: kvs.normalizeKey(key)}
+	switch ttl, ok := kvs.TTL(key); {
+	case !ok:
+		resp.TTLSeconds = ttlMissing
+	case ttl < 0:
+		resp.TTLSeconds = ttlNoExpiry
+	default:
+		// Round to the nearest second like Redis, so a fresh 10s TTL
+		// reads 10 rather than 9.
+		resp.TTLSeconds = int64((ttl + time.Second/2) / time.Second)
+	}
+	sendJSONResponse(w, resp, http.StatusOK)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	TxnGet = "get"
+	TxnSet = "set"
+	TxnDel = "del"
+	TxnCAS = "cas"
+)
+
+// TxnOp is a single operation in a transaction. Value is the value to write
+// for set and cas; Old is the value cas expects to find.
+type TxnOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Old   string `json:"old,omitempty"`
+}
+
+// TxnResult reports the outcome of one operation. For get, Value and Found
+// describe the key as seen at that point in the transaction, with Encoding
+// set as in GetResponse. OK is false only for a cas whose expected value did
+// not match.
+type TxnResult struct {
+	Op       string `json:"op"`
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Found    bool   `json:"found"`
+	OK       bool   `json:"ok"`
+}
+
+type TxnRequest struct {
+	Ops []TxnOp `json:"ops"`
+}
+
+type TxnResponse struct {
+	Committed bool        `json:"committed"`
+	Results   []TxnResult `json:"results"`
+}
+
+var errUnknownTxnOp = errors.New("unknown transaction operation")
+
+// Txn executes ops in order as one atomic unit under the write lock. Later
+// operations observe the effects of earlier ones. If any cas fails, nothing
+// is written and committed is false.
+func (kvs *KeyValueStore) Txn(ops []TxnOp) (results []TxnResult, committed bool, err error) {
+	for i := range ops {
+		switch ops[i].Op {
+		case TxnGet, TxnSet, TxnDel, TxnCAS:
+		default:
+			return nil, false, errUnknownTxnOp
+		}
+		ops[i].Key = kvs.normalizeKey(ops[i].Key)
+		if ops[i].Op == TxnSet || ops[i].Op == TxnCAS {
+			if err := kvs.validateKey(ops[i].Key); err != nil {
+				return nil, false, err
+			}
+			if err := kvs.validateValue(ops[i].Value); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+
+	// Writes are staged in pending (nil meaning deleted) and only applied
+	// once every operation has succeeded.
+	pending := make(map[string]*string)
+	now := time.Now()
+	lookup := func(key string) (string, bool) {
+		if value, ok := pending[key]; ok {
+			if value == nil {
+				return "", false
+			}
+			return *value, true
+		}
+		return kvs.lookupLocked(key, now)
+	}
+
+	committed = true
+	results = make([]TxnResult, len(ops))
+	for i, op := range ops {
+		current, found := lookup(op.Key)
+		result := TxnResult{Op: op.Op, Key: op.Key, Found: found, OK: true}
+
+		switch op.Op {
+		case TxnGet:
+			result.Value = current
+			kvs.ops.gets.Add(1)
+			kvs.recordAccess(op.Key, false)
+		case TxnSet:
+			value := op.Value
+			pending[op.Key] = &value
+		case TxnDel:
+			pending[op.Key] = nil
+		case TxnCAS:
+			if !found || current != op.Old {
+				result.OK = false
+				committed = false
+			} else {
+				value := op.Value
+				pending[op.Key] = &value
+			}
+		}
+		results[i] = result
+	}
+
+	if !committed {
+		return results, false, nil
+	}
+
+	// Check quotas for every key the transaction creates up front, so the
+	// writes below cannot fail halfway through. Deletes in the same
+	// transaction are not credited against the quota.
+	var created []string
+	for key, value := range pending {
+		if value != nil {
+			created = append(created, key)
+		}
+	}
+	if err := kvs.checkQuotaLocked(created...); err != nil {
+		return nil, false, err
+	}
+	if err := kvs.checkCapacityLocked(created...); err != nil {
+		return nil, false, err
+	}
+
+	for key, value := range pending {
+		if value == nil {
+			kvs.deleteLocked(key)
+		} else if err := kvs.setLocked(key, *value); err != nil {
+			return nil, false, err
+		}
+	}
+	return results, true, nil
+}
+
+func (kvs *KeyValueStore) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidBody, Error: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+
+	var req TxnRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidJSON, Error: "Error parsing JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	for _, op := range req.Ops {
+		if kvs.normalizeKey(op.Key) == "" {
+			sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	end := startSpan(r.Context(), "store.Txn", "")
+	results, committed, err := kvs.Txn(req.Ops)
+	end()
+	if errors.Is(err, errUnknownTxnOp) {
+		sendJSONResponse(w, ErrorResponse{Code: CodeUnknownOperation, Error: "Unknown operation"}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendWriteError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusConflict
+	} else if err := kvs.persistWrite(r.Context()); err != nil {
+		log.Printf("Error saving to disk: %v", err)
+		kvs.sendInternalError(w, "Error saving to disk", err)
+		return
+	}
+	for i := range results {
+		results[i].Value, results[i].Encoding = encodeValue(results[i].Value)
+	}
+	sendJSONResponse(w, TxnResponse{Committed: committed, Results: results}, status)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+)
+
+// uiFiles holds the /ui page, a single HTML file that browses the store
+// through the existing JSON endpoints.
+//
+//go:embed ui/index.html
+var uiFiles embed.FS
+
+// handleUI serves the browser UI. It is only available while API keys are
+// configured, since the page can change and delete any key, and read-only
+// keys are refused by allowedForRead.
+func (s *apiKeyStore) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendMethodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	if s.Load() == nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeFeatureDisabled, Error: "The UI requires -credentials-file"}, http.StatusNotFound)
+		return
+	}
+
+	http.ServeFileFS(w, r, uiFiles, "ui/index.html")
+}
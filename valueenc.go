@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// encodingBase64 marks a value that isn't valid UTF-8 and so is carried
+// base64-encoded wherever it has to go through a JSON string: the snapshot,
+// the write-ahead log and every response that returns values. JSON strings
+// can only hold UTF-8, and encoding/json would otherwise replace the invalid
+// bytes of a bitmap or a raw PUT /kv body with U+FFFD.
+const encodingBase64 = "base64"
+
+// encodeValue returns value unchanged if it is valid UTF-8, and otherwise
+// its base64 encoding along with encodingBase64.
+func encodeValue(value string) (encoded, encoding string) {
+	if utf8.ValidString(value) {
+		return value, ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte(value)), encodingBase64
+}
+
+// decodeValue reverses encodeValue.
+func decodeValue(encoded, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return encoded, nil
+	case encodingBase64:
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("unknown value encoding %q", encoding)
+	}
+}
+
+// taggedValue stands in for a value in a snapshot when the value isn't valid
+// UTF-8. Keeping the encoding next to the encoded value in the data file,
+// rather than in the metadata file, means a crash between the two files' renames
+// can never pair a value with the wrong encoding.
+type taggedValue struct {
+	Encoding string `json:"encoding"`
+	Value    string `json:"value"`
+}
+
+// snapshotData returns what to write to a snapshot file for store: store
+// itself when every value is valid UTF-8, as is usual, and otherwise a copy
+// holding a taggedValue in place of each value that isn't.
+func snapshotData(store map[string]string) any {
+	var data map[string]any
+	for key, value := range store {
+		encoded, encoding := encodeValue(value)
+		if encoding == "" {
+			continue
+		}
+		if data == nil {
+			data = make(map[string]any, len(store))
+			for k, v := range store {
+				data[k] = v
+			}
+		}
+		data[key] = taggedValue{Encoding: encoding, Value: encoded}
+	}
+	if data == nil {
+		return store
+	}
+	return data
+}
+
+// decodeSnapshot decodes a snapshot written from snapshotData into store.
+// Snapshots without tagged values decode in a single pass straight into
+// the map.
+func decodeSnapshot(data []byte, store map[string]string) error {
+	err := json.Unmarshal(data, &store)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for key, r := range raw {
+		var value string
+		if err := json.Unmarshal(r, &value); err == nil {
+			store[key] = value
+			continue
+		}
+		var tagged taggedValue
+		if err := json.Unmarshal(r, &tagged); err != nil {
+			return fmt.Errorf("value of %q: %w", key, err)
+		}
+		decoded, err := decodeValue(tagged.Value, tagged.Encoding)
+		if err != nil {
+			return fmt.Errorf("value of %q: %w", key, err)
+		}
+		store[key] = decoded
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// valueIndex maps each value to the set of keys holding it, so lookups by
+// value don't scan the store. It is guarded by kvs.mu.
+type valueIndex struct {
+	keys map[string]map[string]struct{}
+}
+
+func newValueIndex() *valueIndex {
+	return &valueIndex{keys: make(map[string]map[string]struct{})}
+}
+
+func (ix *valueIndex) add(value, key string) {
+	set, ok := ix.keys[value]
+	if !ok {
+		set = make(map[string]struct{})
+		ix.keys[value] = set
+	}
+	set[key] = struct{}{}
+}
+
+func (ix *valueIndex) remove(value, key string) {
+	set, ok := ix.keys[value]
+	if !ok {
+		return
+	}
+	delete(set, key)
+	if len(set) == 0 {
+		delete(ix.keys, value)
+	}
+}
+
+func (ix *valueIndex) rebuild(store map[string]string) {
+	ix.keys = make(map[string]map[string]struct{})
+	for key, value := range store {
+		ix.add(value, key)
+	}
+}
+
+// FindByValueResponse echoes the value searched for, encoded as in
+// GetResponse.
+type FindByValueResponse struct {
+	Value    string   `json:"value"`
+	Encoding string   `json:"encoding,omitempty"`
+	Keys     []string `json:"keys"`
+}
+
+// FindByValue returns the live keys holding value, sorted.
+func (kvs *KeyValueStore) FindByValue(value string) []string {
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(kvs.valueIndex.keys[value]))
+	for key := range kvs.valueIndex.keys[value] {
+		if _, ok := kvs.lookupLocked(key, now); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (kvs *KeyValueStore) handleFindByValue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	if kvs.valueIndex == nil {
+		sendJSONResponse(w, ErrorResponse{Code: CodeFeatureDisabled, Error: "Value index is not enabled"}, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if !query.Has("value") {
+		sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Missing value"}, http.StatusBadRequest)
+		return
+	}
+	value := query.Get("value")
+
+	keys := kvs.FindByValue(value)
+	encoded, encoding := encodeValue(value)
+	sendJSONResponse(w, FindByValueResponse{Value: encoded, Encoding: encoding, Keys: keys}, http.StatusOK)
+}
@@ -0,0 +1,65 @@
+package main
+
+import "net/http"
+
+// valueSizeBounds are the exclusive upper bounds of the value size buckets.
+// Values at least as large as the last bound fall into a final overflow
+// bucket.
+var valueSizeBounds = []int{64, 1 << 10, 64 << 10, 1 << 20}
+
+var valueSizeLabels = []string{"0-63B", "64B-1KB", "1KB-64KB", "64KB-1MB", "1MB+"}
+
+// sizeHistogram counts values by size bucket. It is updated incrementally
+// on every write and delete and guarded by kvs.mu.
+type sizeHistogram struct {
+	counts [5]int
+}
+
+func sizeBucket(n int) int {
+	for i, bound := range valueSizeBounds {
+		if n < bound {
+			return i
+		}
+	}
+	return len(valueSizeBounds)
+}
+
+func (h *sizeHistogram) add(value string, delta int) {
+	h.counts[sizeBucket(len(value))] += delta
+}
+
+func (h *sizeHistogram) rebuild(store map[string]string) {
+	h.counts = [5]int{}
+	for _, value := range store {
+		h.add(value, 1)
+	}
+}
+
+type ValueSizeBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+type ValueSizesResponse struct {
+	Buckets []ValueSizeBucket `json:"buckets"`
+}
+
+// ValueSizes returns the current value size distribution.
+func (kvs *KeyValueStore) ValueSizes() []ValueSizeBucket {
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	buckets := make([]ValueSizeBucket, len(valueSizeLabels))
+	for i, label := range valueSizeLabels {
+		buckets[i] = ValueSizeBucket{Bucket: label, Count: kvs.sizes.counts[i]}
+	}
+	return buckets
+}
+
+func (kvs *KeyValueStore) handleValueSizes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	sendJSONResponse(w, ValueSizesResponse{Buckets: kvs.ValueSizes()}, http.StatusOK)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// maxVerifyKeys bounds how many differing keys of each kind are listed.
+const maxVerifyKeys = 100
+
+type VerifyResponse struct {
+	// Consistent is true when the data file matches memory exactly.
+	Consistent bool `json:"consistent"`
+	// Dirty reports unsaved changes, which make differences expected.
+	Dirty        bool     `json:"dirty"`
+	MemoryKeys   int      `json:"memory_keys"`
+	DiskKeys     int      `json:"disk_keys"`
+	OnlyInMemory []string `json:"only_in_memory"`
+	OnlyOnDisk   []string `json:"only_on_disk"`
+	Different    []string `json:"different"`
+	// Truncated is set when any list was cut at maxVerifyKeys.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Verify loads the data file and diffs it against the live store. saveMu is
+// held throughout so a save can't land between reading the file and
+// comparing it; writes can still happen and show up as Dirty.
+func (kvs *KeyValueStore) Verify() (VerifyResponse, error) {
+	kvs.saveMu.Lock()
+	defer kvs.saveMu.Unlock()
+
+	disk := make(map[string]string)
+	data, err := os.ReadFile(kvs.dataPath())
+	if err != nil && !os.IsNotExist(err) {
+		return VerifyResponse{}, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &disk); err != nil {
+			return VerifyResponse{}, err
+		}
+	}
+
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+
+	resp := VerifyResponse{
+		Dirty:        kvs.dirty,
+		MemoryKeys:   len(kvs.store),
+		DiskKeys:     len(disk),
+		OnlyInMemory: []string{},
+		OnlyOnDisk:   []string{},
+		Different:    []string{},
+	}
+	for key, value := range kvs.store {
+		diskValue, ok := disk[key]
+		switch {
+		case !ok:
+			resp.OnlyInMemory = append(resp.OnlyInMemory, key)
+		case diskValue != value:
+			resp.Different = append(resp.Different, key)
+		}
+	}
+	for key := range disk {
+		if _, ok := kvs.store[key]; !ok {
+			resp.OnlyOnDisk = append(resp.OnlyOnDisk, key)
+		}
+	}
+	resp.Consistent = len(resp.OnlyInMemory) == 0 && len(resp.OnlyOnDisk) == 0 && len(resp.Different) == 0
+
+	for _, keys := range []*[]string{&resp.OnlyInMemory, &resp.OnlyOnDisk, &resp.Different} {
+		sort.Strings(*keys)
+		if len(*keys) > maxVerifyKeys {
+			*keys = (*keys)[:maxVerifyKeys]
+			resp.Truncated = true
+		}
+	}
+	return resp, nil
+}
+
+func (kvs *KeyValueStore) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	resp, err := kvs.Verify()
+	if err != nil {
+		log.Printf("Error verifying data file: %v", err)
+		kvs.sendInternalError(w, "Error reading data file", err)
+		return
+	}
+	sendJSONResponse(w, resp, http.StatusOK)
+}
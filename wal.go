@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// walFile records every mutation since the last snapshot of the data file:
+// values, TTLs and content types.
+const walFile = "kvstore.wal"
+
+// walRecord is one logged mutation. Each is framed on disk by an 8-byte
+// header, the big-endian length of its JSON encoding followed by that
+// encoding's CRC-32C, so replay can tell a complete record from one cut
+// short by a crash.
+type walRecord struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// Encoding is encodingBase64 when Value is the base64 encoding of a
+	// value that isn't valid UTF-8.
+	Encoding  string     `json:"encoding,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ModifiedAt is the key's modification time, on set records.
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+}
+
+// A set record carries only the value and its modification time; the TTL and content type changes
+// that go with it are logged as records of their own. A del removes the key
+// with all of its metadata, and a clear empties the whole store.
+const (
+	walOpSet         = "set"
+	walOpDel         = "del"
+	walOpExpire      = "expire"
+	walOpPersist     = "persist"
+	walOpContentType = "content_type"
+	walOpClear       = "clear"
+)
+
+const walHeaderSize = 8
+
+var walCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errWALTorn and errWALChecksum describe a record replay can't use.
+var (
+	errWALTorn     = errors.New("incomplete record")
+	errWALChecksum = errors.New("checksum mismatch")
+)
+
+// appendWALRecord appends the framed encoding of rec to buf.
+func appendWALRecord(buf []byte, rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return buf, err
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(payload, walCRCTable))
+	return append(buf, payload...), nil
+}
+
+// readWALRecord reads one framed record from r. It returns io.EOF at a
+// clean end of the log, errWALTorn if the log ends partway through a
+// record and errWALChecksum if a complete record doesn't match its
+// checksum. n is the number of bytes the record took up.
+func readWALRecord(r io.Reader) (rec walRecord, n int64, err error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+		return rec, 0, io.EOF
+	} else if err == io.ErrUnexpectedEOF {
+		return rec, 0, errWALTorn
+	} else if err != nil {
+		return rec, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	// Copying through a limited reader rather than allocating size bytes up
+	// front keeps a garbage length from exhausting memory.
+	var payload bytes.Buffer
+	if m, err := io.Copy(&payload, io.LimitReader(r, int64(size))); err != nil {
+		return rec, 0, err
+	} else if m < int64(size) {
+		return rec, 0, errWALTorn
+	}
+	if crc32.Checksum(payload.Bytes(), walCRCTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return rec, 0, errWALChecksum
+	}
+	if err := json.Unmarshal(payload.Bytes(), &rec); err != nil {
+		return rec, 0, fmt.Errorf("decoding record: %w", err)
+	}
+	return rec, walHeaderSize + int64(size), nil
+}
+
+// writeAheadLog appends mutations to walFile in exactly the order they were
+// applied in memory. Records are queued under kvs.mu, which fixes their
+// order, and a single writer goroutine appends and fsyncs them in batches.
+// Durability is tracked as a sequence number that only moves forward, so
+// once a write is acknowledged durable, every write applied before it is
+// on disk too: recovery can never see B without an earlier A.
+type writeAheadLog struct {
+	// fileMu serializes the writer with reset, so a batch taken before a
+	// snapshot can't be appended after the log was truncated.
+	fileMu sync.Mutex
+	path   string
+	file   *os.File
+	fsync  bool
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []walRecord
+	appended uint64
+	durable  uint64
+	err      error
+	wake     chan struct{}
+}
+
+func openWAL(path string, fsync bool) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &writeAheadLog{path: path, file: file, fsync: fsync, wake: make(chan struct{}, 1)}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w, nil
+}
+
+// append queues rec and returns its sequence number. Callers must hold
+// kvs.mu for writing so queue order matches the order of the in-memory
+// changes.
+func (w *writeAheadLog) append(rec walRecord) uint64 {
+	w.mu.Lock()
+	w.pending = append(w.pending, rec)
+	w.appended++
+	seq := w.appended
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return seq
+}
+
+// lastSeq returns the sequence number of the most recently queued record.
+func (w *writeAheadLog) lastSeq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.appended
+}
+
+// waitDurable blocks until every record up to seq is on disk.
+func (w *writeAheadLog) waitDurable(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.durable < seq && w.err == nil {
+		w.cond.Wait()
+	}
+	return w.err
+}
+
+// run is the single writer. Each wake-up drains everything queued so far
+// into one write and one fsync, so concurrent writers share the cost.
+func (w *writeAheadLog) run() {
+	for range w.wake {
+		w.fileMu.Lock()
+		w.mu.Lock()
+		batch := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+
+		err := w.writeBatch(batch)
+
+		w.mu.Lock()
+		if err != nil {
+			// A failed append leaves the log's tail unknown, so stop
+			// acknowledging anything until a snapshot resets it.
+			log.Printf("Error appending to %s: %v", w.path, err)
+			w.err = err
+		} else if w.err == nil {
+			w.durable += uint64(len(batch))
+		}
+		w.cond.Broadcast()
+		w.mu.Unlock()
+		w.fileMu.Unlock()
+	}
+}
+
+func (w *writeAheadLog) writeBatch(batch []walRecord) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	// The batch goes out in one write, so a crash tears at most the
+	// records at its end.
+	var buf []byte
+	for _, rec := range batch {
+		var err error
+		if buf, err = appendWALRecord(buf, rec); err != nil {
+			return err
+		}
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+	if w.fsync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+// reset empties the log after a snapshot has captured everything in it,
+// including records still queued, and releases their waiters. Callers must
+// hold kvs.mu for writing so nothing is queued meanwhile.
+func (w *writeAheadLog) reset() error {
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if w.fsync {
+		if err := w.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	w.pending = nil
+	w.durable = w.appended
+	w.err = nil
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	return nil
+}
+
+// logSetLocked and the other log functions queue a mutation when -wal is
+// on. Callers must hold kvs.mu for writing.
+func (kvs *KeyValueStore) logSetLocked(key, value string) {
+	if kvs.wal != nil {
+		encoded, encoding := encodeValue(value)
+		rec := walRecord{Op: walOpSet, Key: key, Value: encoded, Encoding: encoding}
+		if modified, ok := kvs.modified[key]; ok {
+			rec.ModifiedAt = &modified
+		}
+		kvs.wal.append(rec)
+	}
+}
+
+func (kvs *KeyValueStore) logDeleteLocked(key string) {
+	if kvs.wal != nil {
+		kvs.wal.append(walRecord{Op: walOpDel, Key: key})
+	}
+}
+
+func (kvs *KeyValueStore) logExpireLocked(key string, at time.Time) {
+	if kvs.wal != nil {
+		kvs.wal.append(walRecord{Op: walOpExpire, Key: key, ExpiresAt: &at})
+	}
+}
+
+func (kvs *KeyValueStore) logPersistLocked(key string) {
+	if kvs.wal != nil {
+		kvs.wal.append(walRecord{Op: walOpPersist, Key: key})
+	}
+}
+
+func (kvs *KeyValueStore) logContentTypeLocked(key, contentType string) {
+	if kvs.wal != nil {
+		kvs.wal.append(walRecord{Op: walOpContentType, Key: key, Value: contentType})
+	}
+}
+
+// logStoreLocked logs the whole store as a clear followed by every key
+// with its metadata, for changes that replace the map wholesale.
+func (kvs *KeyValueStore) logStoreLocked() {
+	if kvs.wal == nil {
+		return
+	}
+	kvs.wal.append(walRecord{Op: walOpClear})
+	for key, value := range kvs.store {
+		kvs.logKeyLocked(key, value)
+	}
+}
+
+// logKeyLocked logs key's value along with its TTL and content type.
+func (kvs *KeyValueStore) logKeyLocked(key, value string) {
+	kvs.logSetLocked(key, value)
+	if at, ok := kvs.expiries.get(key); ok {
+		kvs.logExpireLocked(key, at)
+	}
+	if contentType, ok := kvs.contentTypes[key]; ok {
+		kvs.logContentTypeLocked(key, contentType)
+	}
+}
+
+// applyWALRecord applies one replayed record to the store and reports
+// whether its op was known.
+func (kvs *KeyValueStore) applyWALRecord(rec walRecord) bool {
+	switch rec.Op {
+	case walOpSet:
+		value, err := decodeValue(rec.Value, rec.Encoding)
+		if err != nil {
+			log.Printf("Ignoring undecodable %s record for %q: %v", kvs.walPath(), rec.Key, err)
+			return false
+		}
+		kvs.store[rec.Key] = value
+		if rec.ModifiedAt != nil {
+			kvs.modified[rec.Key] = *rec.ModifiedAt
+		}
+	case walOpDel:
+		delete(kvs.store, rec.Key)
+		kvs.expiries.remove(rec.Key)
+		delete(kvs.contentTypes, rec.Key)
+		delete(kvs.modified, rec.Key)
+	case walOpExpire:
+		if rec.ExpiresAt == nil {
+			log.Printf("Ignoring %s expire record for %q without a time", kvs.walPath(), rec.Key)
+			return false
+		}
+		kvs.expiries.set(rec.Key, *rec.ExpiresAt)
+	case walOpPersist:
+		kvs.expiries.remove(rec.Key)
+	case walOpContentType:
+		if rec.Value == "" {
+			delete(kvs.contentTypes, rec.Key)
+		} else {
+			kvs.contentTypes[rec.Key] = rec.Value
+		}
+	case walOpClear:
+		clear(kvs.store)
+		kvs.expiries = newExpiryQueue()
+		clear(kvs.contentTypes)
+		clear(kvs.modified)
+	default:
+		log.Printf("Ignoring unknown %s record op %q", kvs.walPath(), rec.Op)
+		return false
+	}
+	return true
+}
+
+// replayWAL applies walFile on top of the snapshot loaded from the data file and
+// reports how many records it applied, and how many bytes of the log those
+// took up. A torn final record, left by a crash mid-append, ends the
+// replay: that write was never acknowledged, and nothing after it can be
+// trusted to be in order. A complete record that fails its checksum ends
+// it too, but is not something a crash leaves behind, so corrupt reports
+// it.
+func (kvs *KeyValueStore) replayWAL() (applied int, valid int64, corrupt bool, err error) {
+	path := kvs.walPath()
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, 0, false, nil
+	} else if err != nil {
+		return 0, 0, false, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		rec, n, err := readWALRecord(r)
+		if err == io.EOF {
+			return applied, valid, false, nil
+		} else if errors.Is(err, errWALTorn) || errors.Is(err, errWALChecksum) {
+			log.Printf("Stopping %s replay after %d records at offset %d: %v", path, applied, valid, err)
+			return applied, valid, errors.Is(err, errWALChecksum), nil
+		} else if err != nil {
+			return applied, valid, false, fmt.Errorf("reading %s at offset %d: %w", path, valid, err)
+		}
+		valid += n
+		if kvs.applyWALRecord(rec) {
+			applied++
+		}
+	}
+}
+
+// openWAL replays any log left by the previous run and starts logging. The
+// replayed writes only live in memory and the log until the next snapshot,
+// so the store is marked dirty to take one soon. Anything after the last
+// good record is cut off first, or new records appended behind it would
+// never be replayed. If replay stopped at a checksum mismatch, the records
+// cut off may have been acknowledged, so the whole log is copied aside for
+// inspection before it is truncated.
+func (kvs *KeyValueStore) openWAL() error {
+	applied, valid, corrupt, err := kvs.replayWAL()
+	if err != nil {
+		return err
+	}
+	path := kvs.walPath()
+	if applied > 0 {
+		log.Printf("Replayed %d records from %s", applied, path)
+		kvs.dirty = true
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() > valid {
+		if corrupt {
+			saved := path + ".corrupt-" + time.Now().UTC().Format(backupTimeFormat)
+			if err := copyFile(path, saved); err != nil {
+				return fmt.Errorf("%s is corrupt at offset %d and could not be copied aside: %w", path, valid, err)
+			}
+			log.Printf("WARNING: %s is corrupt at offset %d; discarding %d bytes after the last good record, which may include acknowledged writes. The full log was saved to %s", path, valid, info.Size()-valid, saved)
+		} else {
+			log.Printf("Discarding %d bytes after the last complete record in %s", info.Size()-valid, path)
+		}
+		if err := os.Truncate(path, valid); err != nil {
+			return err
+		}
+	}
+
+	wal, err := openWAL(path, kvs.cfg.FsyncPolicy != FsyncNever)
+	if err != nil {
+		return err
+	}
+	kvs.wal = wal
+	return nil
+}
+
+// copyFile copies src to a new file dst and syncs it.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
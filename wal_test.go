@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func walTestStore(t *testing.T) *KeyValueStore {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.WAL = true
+	return newTestStore(t, cfg)
+}
+
+func TestWALReplaysTTLs(t *testing.T) {
+	kvs := walTestStore(t)
+	if err := kvs.SetManyTTL([]SetTTLEntry{
+		{Key: "expiring", Value: "a", TTLSeconds: 3600},
+		{Key: "persisted", Value: "b", TTLSeconds: 3600},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// A plain set drops the TTL again.
+	if err := kvs.Set("persisted", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs = reopen(t, kvs)
+	if ttl, ok := kvs.TTL("expiring"); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("expiring TTL = %v, %v; want about an hour", ttl, ok)
+	}
+	if ttl, ok := kvs.TTL("persisted"); !ok || ttl >= 0 {
+		t.Errorf("persisted TTL = %v, %v; want no expiry", ttl, ok)
+	}
+}
+
+func TestWALReplaysTTLKeptByUpdate(t *testing.T) {
+	kvs := walTestStore(t)
+	if err := kvs.SetManyTTL([]SetTTLEntry{{Key: "k", Value: "abc", TTLSeconds: 3600}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kvs.SetRange("k", 1, "X"); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("k"); got != "aXc" {
+		t.Errorf("Get = %q, want %q", got, "aXc")
+	}
+	if ttl, ok := kvs.TTL("k"); !ok || ttl <= 0 {
+		t.Errorf("TTL = %v, %v; want the TTL kept through SetRange", ttl, ok)
+	}
+}
+
+func TestWALReplaysContentTypes(t *testing.T) {
+	kvs := walTestStore(t)
+	if _, _, err := kvs.Swap("typed", "{}", "application/json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := kvs.Swap("cleared", "<p>", "text/html"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.Set("cleared", "plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs = reopen(t, kvs)
+	if _, contentType, _ := kvs.GetRaw("typed"); contentType != "application/json" {
+		t.Errorf("typed content type = %q, want application/json", contentType)
+	}
+	if _, contentType, _ := kvs.GetRaw("cleared"); contentType != "" {
+		t.Errorf("cleared content type = %q, want none", contentType)
+	}
+}
+
+func TestWALReplaysReplaceAll(t *testing.T) {
+	kvs := walTestStore(t)
+	if err := kvs.Set("old", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.ReplaceAll(map[string]string{"new": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs = reopen(t, kvs)
+	if _, ok := kvs.Get("old"); ok {
+		t.Error("key from before ReplaceAll came back")
+	}
+	if got, _ := kvs.Get("new"); got != "2" {
+		t.Errorf("new = %q, want %q", got, "2")
+	}
+}
+
+func TestWALReplaysRekey(t *testing.T) {
+	kvs := walTestStore(t)
+	if err := kvs.SetManyTTL([]SetTTLEntry{
+		{Key: "a:1", Value: "one", TTLSeconds: 3600},
+		{Key: "a:a:1", Value: "two"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	// a:a:1 becomes a:1 while a:1 itself becomes 1, so the log must not
+	// delete a:1 after writing it as a target.
+	if report, err := kvs.Rekey(RekeyRequest{Mode: RekeyStripPrefix, Prefix: "a:"}); err != nil || !report.Applied {
+		t.Fatalf("Rekey = %+v, %v", report, err)
+	}
+
+	kvs = reopen(t, kvs)
+	if got, _ := kvs.Get("1"); got != "one" {
+		t.Errorf("1 = %q, want %q", got, "one")
+	}
+	if got, _ := kvs.Get("a:1"); got != "two" {
+		t.Errorf("a:1 = %q, want %q", got, "two")
+	}
+	if _, ok := kvs.Get("a:a:1"); ok {
+		t.Error("renamed key a:a:1 came back")
+	}
+	if ttl, ok := kvs.TTL("1"); !ok || ttl <= 0 {
+		t.Errorf("TTL of 1 = %v, %v; want the TTL moved with the key", ttl, ok)
+	}
+	if ttl, ok := kvs.TTL("a:1"); !ok || ttl >= 0 {
+		t.Errorf("TTL of a:1 = %v, %v; want none, as a:a:1 had none", ttl, ok)
+	}
+}
+
+func TestWALReplaysModifiedTimes(t *testing.T) {
+	kvs := walTestStore(t)
+	if err := kvs.Set("k", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.saveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvs.Set("k", "2"); err != nil {
+		t.Fatal(err)
+	}
+	asOf := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := kvs.Merge(map[string]string{"merged": "m"}, MergeOverwrite, asOf); err != nil {
+		t.Fatal(err)
+	}
+	kvs.mu.RLock()
+	want := kvs.modified["k"]
+	kvs.mu.RUnlock()
+
+	kvs = reopen(t, kvs)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	if got := kvs.modified["k"]; !got.Equal(want) {
+		t.Errorf("k modified at %v after replay, want %v", got, want)
+	}
+	if got := kvs.modified["merged"]; !got.Equal(asOf) {
+		t.Errorf("merged modified at %v after replay, want the merge's as-of time %v", got, asOf)
+	}
+}
+
+// testWAL returns the framed encoding of count set records, k0=v0 onwards,
+// and the offset at which each record ends.
+func testWAL(t *testing.T, count int) (log []byte, ends []int) {
+	t.Helper()
+	for i := range count {
+		var err error
+		// Growing values give the length headers more than one
+		// significant byte.
+		rec := walRecord{Op: walOpSet, Key: fmt.Sprintf("k%d", i), Value: fmt.Sprintf("v%d", i) + strings.Repeat("x", i*100)}
+		if log, err = appendWALRecord(log, rec); err != nil {
+			t.Fatal(err)
+		}
+		ends = append(ends, len(log))
+	}
+	return log, ends
+}
+
+func TestWALTruncatedAtEveryOffset(t *testing.T) {
+	full, ends := testWAL(t, 4)
+	for offset := 0; offset <= len(full); offset++ {
+		complete := 0
+		for complete < len(ends) && ends[complete] <= offset {
+			complete++
+		}
+		valid := 0
+		if complete > 0 {
+			valid = ends[complete-1]
+		}
+
+		cfg := testConfig(t)
+		cfg.WAL = true
+		if err := os.WriteFile(filepath.Join(cfg.DataDir, walFile), full[:offset], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		kvs := newTestStore(t, cfg)
+		if n := kvs.Count(); n != complete {
+			t.Fatalf("offset %d: replayed %d keys, want %d", offset, n, complete)
+		}
+		if info, err := os.Stat(kvs.walPath()); err != nil || info.Size() != int64(valid) {
+			t.Fatalf("offset %d: log left at %v bytes (%v), want %d", offset, info.Size(), err, valid)
+		}
+
+		// New records must land after the last good one and replay.
+		if err := kvs.Set("after", "x"); err != nil {
+			t.Fatal(err)
+		}
+		kvs = reopen(t, kvs)
+		if n := kvs.Count(); n != complete+1 {
+			t.Fatalf("offset %d: after a second replay %d keys, want %d", offset, n, complete+1)
+		}
+		if got, _ := kvs.Get("after"); got != "x" {
+			t.Fatalf("offset %d: write after the truncation was lost", offset)
+		}
+	}
+}
+
+func TestWALChecksumMismatchKeepsCopy(t *testing.T) {
+	full, ends := testWAL(t, 3)
+	corrupted := bytes.Clone(full)
+	corrupted[ends[0]+walHeaderSize+2] ^= 0xff
+
+	cfg := testConfig(t)
+	cfg.WAL = true
+	path := filepath.Join(cfg.DataDir, walFile)
+	if err := os.WriteFile(path, corrupted, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kvs := newTestStore(t, cfg)
+	if n := kvs.Count(); n != 1 {
+		t.Errorf("replayed %d keys, want only the record before the corruption", n)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != int64(ends[0]) {
+		t.Errorf("log not truncated to the last good record: %v, %v", info.Size(), err)
+	}
+
+	copies, _ := filepath.Glob(path + ".corrupt-*")
+	if len(copies) != 1 {
+		t.Fatalf("found %d copies of the corrupt log, want 1", len(copies))
+	}
+	if saved, err := os.ReadFile(copies[0]); err != nil || !bytes.Equal(saved, corrupted) {
+		t.Errorf("copy of the corrupt log differs from it (%v)", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+// watchRegistry hands out per-key channels that are closed the next time
+// the key is written or deleted. A fresh channel is created for each change,
+// so a closed channel always means "changed since you looked". Entries are
+// counted by their waiters and removed when the last one leaves, so watching
+// keys that are never written doesn't grow the registry.
+type watchRegistry struct {
+	mu   sync.Mutex
+	keys map[string]*watchEntry
+}
+
+type watchEntry struct {
+	ch      chan struct{}
+	waiters int
+}
+
+func newWatchRegistry() *watchRegistry {
+	return &watchRegistry{keys: make(map[string]*watchEntry)}
+}
+
+// channel registers a waiter on key. The caller must call release once it
+// stops waiting, whether or not the channel was closed.
+func (wr *watchRegistry) channel(key string) (ch <-chan struct{}, release func()) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	entry, ok := wr.keys[key]
+	if !ok {
+		entry = &watchEntry{ch: make(chan struct{})}
+		wr.keys[key] = entry
+	}
+	entry.waiters++
+	return entry.ch, func() { wr.release(key, entry) }
+}
+
+// release drops a waiter from entry, removing it from the registry with
+// its last waiter unless a change has already replaced it.
+func (wr *watchRegistry) release(key string, entry *watchEntry) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	entry.waiters--
+	if entry.waiters == 0 && wr.keys[key] == entry {
+		delete(wr.keys, key)
+	}
+}
+
+func (wr *watchRegistry) notify(key string) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if entry, ok := wr.keys[key]; ok {
+		close(entry.ch)
+		delete(wr.keys, key)
+	}
+}
+
+func (wr *watchRegistry) notifyAll() {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	for key, entry := range wr.keys {
+		close(entry.ch)
+		delete(wr.keys, key)
+	}
+}
+
+// watch returns the current value of key together with a channel that is
+// closed when it next changes, and the function to call once done waiting on
+// it. Both are taken under the read lock, and writers notify while holding
+// the write lock, so no change can slip in between reading the value and
+// registering for the next change.
+func (kvs *KeyValueStore) watch(key string) (string, bool, <-chan struct{}, func()) {
+	key = kvs.normalizeKey(key)
+	kvs.mu.RLock()
+	defer kvs.mu.RUnlock()
+	value, ok := kvs.lookupLocked(key, time.Now())
+	changed, release := kvs.watchers.channel(key)
+	return value, ok, changed, release
+}
+
+func (kvs *KeyValueStore) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if kvs.normalizeKey(key) == "" {
+		sendJSONResponse(w, ErrorResponse{Code: CodeMissingKey, Error: "Missing key"}, http.StatusBadRequest)
+		return
+	}
+
+	timeout := defaultWatchTimeout
+	if s := r.URL.Query().Get("timeout"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			sendJSONResponse(w, ErrorResponse{Code: CodeInvalidParameter, Error: "Invalid timeout"}, http.StatusBadRequest)
+			return
+		}
+		timeout = min(d, maxWatchTimeout)
+	}
+
+	value, ok, changed, release := kvs.watch(key)
+	defer release()
+
+	// A client that passes the ETag it last saw gets an immediate answer if
+	// the value has already moved on, so changes between polls are not lost.
+	if inm := r.Header.Get("If-None-Match"); inm != "" && !(ok && etagMatches(inm, valueETag(value))) {
+		kvs.sendWatchResult(w, key, value, ok)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+		value, ok = kvs.Get(key)
+		kvs.sendWatchResult(w, key, value, ok)
+	case <-timer.C:
+		w.WriteHeader(http.StatusNotModified)
+	case <-r.Context().Done():
+	}
+}
+
+func (kvs *KeyValueStore) sendWatchResult(w http.ResponseWriter, key, value string, ok bool) {
+	if !ok {
+		sendJSONResponse(w, ErrorResponse{Code: CodeKeyNotFound, Error: "Key not found"}, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", valueETag(value))
+	encoded, encoding := encodeValue(value)
+	sendJSONResponse(w, GetResponse{Key: kvs.normalizeKey(key), Value: encoded, Encoding: encoding, Found: true}, http.StatusOK)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func watchEntries(kvs *KeyValueStore) int {
+	kvs.watchers.mu.Lock()
+	defer kvs.watchers.mu.Unlock()
+	return len(kvs.watchers.keys)
+}
+
+func TestWatchReturnsNewValue(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(kvs.handleWatch, http.MethodGet, "/watch?key=k&timeout=10s", "")
+	}()
+	for watchEntries(kvs) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := kvs.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := <-done
+	var resp GetResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.Value != "v" {
+		t.Errorf("watch: status %d: %s, want 200 with v", rec.Code, rec.Body)
+	}
+	if n := watchEntries(kvs); n != 0 {
+		t.Errorf("%d registry entries left after the change, want 0", n)
+	}
+}
+
+// TestWatchRegistryDoesNotLeak watches many keys that are never written,
+// through timeouts, cancelled requests and If-None-Match answers, and checks
+// that none of them stays registered.
+func TestWatchRegistryDoesNotLeak(t *testing.T) {
+	kvs := newTestStore(t, testConfig(t))
+	if err := kvs.Set("present", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		key := "never" + strconv.Itoa(i)
+		go func() {
+			defer wg.Done()
+			if rec := serve(kvs.handleWatch, http.MethodGet, "/watch?key="+key+"&timeout=10ms", ""); rec.Code != http.StatusNotModified {
+				t.Errorf("timed-out watch: status %d, want 304", rec.Code)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			req := httptest.NewRequest(http.MethodGet, "/watch?key="+key, nil).WithContext(ctx)
+			kvs.handleWatch(httptest.NewRecorder(), req)
+		}()
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/watch?key=present", nil)
+			req.Header.Set("If-None-Match", `"stale"`)
+			kvs.handleWatch(httptest.NewRecorder(), req)
+		}()
+	}
+	wg.Wait()
+
+	if n := watchEntries(kvs); n != 0 {
+		t.Errorf("%d registry entries left after every watcher returned, want 0", n)
+	}
+}
+
+func TestWatchRegistrySharedEntry(t *testing.T) {
+	wr := newWatchRegistry()
+	first, releaseFirst := wr.channel("k")
+	second, releaseSecond := wr.channel("k")
+	if first != second {
+		t.Fatal("two waiters on one key got different channels")
+	}
+
+	releaseFirst()
+	if len(wr.keys) != 1 {
+		t.Fatalf("entry removed while a waiter remains")
+	}
+	wr.notify("k")
+	select {
+	case <-second:
+	default:
+		t.Fatal("notify didn't close the remaining waiter's channel")
+	}
+
+	// A waiter released after a change must not remove the next
+	// generation's entry.
+	_, releaseThird := wr.channel("k")
+	releaseSecond()
+	if len(wr.keys) != 1 {
+		t.Fatalf("releasing a stale waiter removed the current entry")
+	}
+	releaseThird()
+	if len(wr.keys) != 0 {
+		t.Errorf("%d entries left, want 0", len(wr.keys))
+	}
+}